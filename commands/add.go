@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var addCmd = &cobra.Command{
+	Use:   "add <spec>",
+	Short: "Add a plugin to the configuration file",
+	Long: `Add a plugin to the configuration file.
+
+The plugin is added to the end of the plugins list unless --after is set.
+Comments and the order of settings in the configuration file are preserved.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		spec := args[0]
+		after, _ := cmd.Flags().GetString("after")
+		install, _ := cmd.Flags().GetBool("install")
+
+		cf, err := readConfigFile(configFilePath)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		plugins, err := cf.plugins()
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		specs := pluginSpecs(plugins)
+
+		for _, existing := range specs {
+			if specWithoutVersion(existing) == specWithoutVersion(spec) {
+				log.Fatalf("%s is already listed in the configuration file as %s", spec, existing)
+			}
+		}
+
+		index := len(specs)
+		if after != "" {
+			afterIndex, err := findSpec(specs, after)
+			if err != nil {
+				log.Fatalf("%s", err)
+			}
+			index = afterIndex + 1
+		}
+
+		// the spec is checked by the same loaders that load the configuration
+		configs := make([]plugin.Config, 0, len(pluginsConfigs)+1)
+		configs = append(configs, pluginsConfigs[:index]...)
+		configs = append(configs, plugin.Config{Spec: spec})
+		configs = append(configs, pluginsConfigs[index:]...)
+		if _, err := plugin.MakePluginStorage(rootDir, configs); err != nil {
+			log.Fatalf("invalid plugin spec %s: %s", spec, err)
+		}
+
+		node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: spec}
+		plugins.Content = append(plugins.Content[:index], append([]*yaml.Node{node}, plugins.Content[index:]...)...)
+		// a flow style list like `[]` would stay on a single line
+		plugins.Style = 0
+		if err := cf.write(); err != nil {
+			log.Fatalf("%s", err)
+		}
+		log.Infof("added %s to %s", spec, configFilePath)
+		pluginsConfigs = configs
+
+		if !install {
+			log.Info("run `zpm install` to install it")
+			return
+		}
+
+		ps := makePluginStorage()
+		defer lockStorage(ps, true)()
+		defer handleInterrupts(ps)()
+		defer startProgress(ps)()
+		ps.CheckPluginInstalls()
+		ps.InstallAll()
+		writeLock(ps)
+	},
+}
+
+func init() {
+	addCmd.Flags().String(
+		"after",
+		"",
+		"Add the plugin after the specified one (plugins are loaded in the listed order)",
+	)
+	addCmd.Flags().Bool(
+		"install",
+		false,
+		"Install the plugin after it is added",
+	)
+
+	RootCmd.AddCommand(addCmd)
+}
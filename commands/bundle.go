@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/zsh"
+
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// inlineSourcedFiles replaces `source` lines with the contents of the files
+// being sourced. `$0` is set to the path of every inlined file, so plugins
+// that locate their files with `${0:A:h}` keep working.
+func inlineSourcedFiles(lines []string) ([]string, error) {
+	inlined := []string{"ZPM_BUNDLE_ARGZERO=$0"}
+	hasInlined := false
+	for _, line := range lines {
+		path, ok := zsh.SourcedFile(line)
+		if !ok {
+			inlined = append(inlined, line)
+			continue
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while inlining %s", path)
+		}
+		inlined = append(
+			inlined,
+			zsh.Comment("inlined from "+path),
+			zsh.Assign("0", path),
+			string(contents),
+		)
+		hasInlined = true
+	}
+	if !hasInlined {
+		return lines, nil
+	}
+	inlined = append(inlined, "0=$ZPM_BUNDLE_ARGZERO", "unset ZPM_BUNDLE_ARGZERO")
+	return inlined, nil
+}
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Write a static load script that does not require zpm to be installed",
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		inline, _ := cmd.Flags().GetBool("inline")
+
+		ps := makePluginStorage()
+		defer lockStorage(ps, true)()
+		defer handleInterrupts(ps)()
+		defer startProgress(ps)()
+
+		ps.CheckPluginUpdates(true)
+		ps.InstallAll()
+
+		bundleData, err := makeLoadScriptArgs(ps)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		bundleData.Standalone = true
+
+		if inline {
+			for i := range bundleData.Plugins {
+				bundleData.Plugins[i].Exec, err = inlineSourcedFiles(bundleData.Plugins[i].Exec)
+				if err != nil {
+					log.Fatalf("%s", err)
+				}
+			}
+		}
+
+		if output == "" {
+			if err := writeLoadScript(os.Stdout, bundleData); err != nil {
+				log.Fatalf("%s", err)
+			}
+			return
+		}
+
+		var script bytes.Buffer
+		if err := writeLoadScript(&script, bundleData); err != nil {
+			log.Fatalf("%s", err)
+		}
+		if err := ioutil.WriteFile(output, script.Bytes(), 0644); err != nil {
+			log.Fatalf("failed to write the bundle: %s", err)
+		}
+
+		log.Infof("bundle written to %s", output)
+	},
+}
+
+func init() {
+	bundleCmd.Flags().StringP(
+		"output",
+		"o",
+		"",
+		"Write the bundle to the specified file instead of stdout",
+	)
+	bundleCmd.Flags().Bool(
+		"inline",
+		false,
+		"Embed the contents of sourced files into the bundle",
+	)
+
+	RootCmd.AddCommand(bundleCmd)
+}
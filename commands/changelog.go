@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The number of commits shown by `zpm check` for every plugin.
+const checkChangelogLimit = 10
+
+func printChangelog(w io.Writer, name string, changelog *plugin.Changelog, limit int, showFiles bool) {
+	fmt.Fprintf(
+		w,
+		"%s: update from %s to %s (%d new commits)\n",
+		name,
+		changelog.From[:7],
+		changelog.To[:7],
+		len(changelog.Commits),
+	)
+	if !changelog.FastForward {
+		fmt.Fprintln(w, "  WARNING: not a fast-forward update, some installed commits will be discarded")
+	}
+
+	for idx, commit := range changelog.Commits {
+		if limit > 0 && idx == limit {
+			fmt.Fprintf(w, "  ... and %d more\n", len(changelog.Commits)-limit)
+			break
+		}
+		fmt.Fprintf(
+			w,
+			"  %s %s %s: %s\n",
+			commit.Hash[:7],
+			commit.Date.Format("2006-01-02"),
+			commit.Author,
+			commit.Subject,
+		)
+	}
+
+	additions, deletions := 0, 0
+	for _, stat := range changelog.Stats {
+		additions += stat.Additions
+		deletions += stat.Deletions
+		if showFiles {
+			fmt.Fprintf(w, "  %s | +%d -%d\n", stat.Name, stat.Additions, stat.Deletions)
+		}
+	}
+	fmt.Fprintf(
+		w,
+		"  %d files changed, %d insertions(+), %d deletions(-)\n",
+		len(changelog.Stats),
+		additions,
+		deletions,
+	)
+}
+
+// printChangelogs prints the changelogs of all plugins with available updates
+// and the local changes of all plugins in the load order.
+func printChangelogs(w io.Writer, ps *plugin.PluginStorage, limit int, showFiles bool) {
+	for _, name := range ps.LoadOrder {
+		pse := ps.Plugins[name]
+		if !pse.HasUpdate() {
+			if changes := pse.LocalChanges(); len(changes) > 0 {
+				fmt.Fprintf(w, "%s: no updates\n", pse.Name)
+				printLocalChanges(w, changes)
+			}
+			continue
+		}
+		changelog, err := pse.Changelog()
+		if err != nil {
+			log.Errorf("while reading the changelog of %s: %s", pse.Name, err)
+			continue
+		}
+		printChangelog(w, pse.Name, changelog, limit, showFiles)
+		printLocalChanges(w, pse.LocalChanges())
+	}
+}
+
+// printLocalChanges lists the files changed in the worktree of a plugin, which
+// are handled according to the `local_changes` setting on the next update.
+func printLocalChanges(w io.Writer, changes []plugin.LocalChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  WARNING: %d files changed locally\n", len(changes))
+	for _, change := range changes {
+		fmt.Fprintf(w, "  %s: %s\n", change.Status, change.Path)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/github"
 	log "github.com/sirupsen/logrus"
@@ -32,13 +33,19 @@ var checkCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Info("checking for updates...")
 
-		ps, err := plugin.MakePluginStorage(rootDir, pluginsSpecs)
-		if err != nil {
-			log.Fatalf("while reading plugin configurations: %s", err)
-		}
+		ps := makePluginStorage()
+		defer lockStorage(ps, true)()
+		defer handleInterrupts(ps)()
+		defer startProgress(ps)()
 
 		ps.CheckPluginUpdates(false)
+		for _, info := range ps.List() {
+			if info.State == plugin.StateError && info.LastCheck != nil {
+				log.Infof("the last successful check of %s was at %s", info.Name, info.LastCheck.Format(time.RFC1123))
+			}
+		}
 
+		printChangelogs(os.Stdout, ps, checkChangelogLimit, false)
 		if ps.HasUpdates() {
 			log.Info("To install updates, run `zpm update`")
 		}
@@ -58,7 +65,7 @@ var checkCmd = &cobra.Command{
 
 		showVersionUpdateGuide(releaseTag)
 
-		if err := ioutil.WriteFile(filepath.Join(rootDir, ".github_version"), []byte(releaseTag), os.ModePerm); err != nil {
+		if err := ioutil.WriteFile(filepath.Join(stateDir, githubVersionFileName), []byte(releaseTag), os.ModePerm); err != nil {
 			log.Fatalf("failed to write .github_version: %s", err)
 		}
 
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// formatSize formats a number of bytes for humans.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size) / unit
+	for _, suffix := range []string{"KiB", "MiB", "GiB"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f TiB", value)
+}
+
+// confirm asks a yes/no question. Anything except "y" and "yes" is a no,
+// including the end of the input.
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Delete plugins that are no longer configured",
+	Long: `Delete plugins that are no longer configured.
+
+Repositories in the plugin storage that none of the configured plugins resolve
+to are listed with their sizes and deleted after confirmation. Directories of
+local plugins (dir://) are never deleted.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		yes, _ := cmd.Flags().GetBool("yes")
+
+		ps := makePluginStorage()
+		defer lockStorage(ps, true)()
+		orphans, err := ps.Orphans()
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		if len(orphans) == 0 {
+			log.Info("no orphaned plugins found")
+			return
+		}
+
+		var total int64
+		for _, orphan := range orphans {
+			fmt.Printf("%s\t%s\n", formatSize(orphan.Size), orphan.Path)
+			total += orphan.Size
+		}
+		if dryRun {
+			return
+		}
+
+		question := fmt.Sprintf("Delete %d orphaned plugins (%s)?", len(orphans), formatSize(total))
+		if !yes && !confirm(os.Stdin, os.Stdout, question) {
+			log.Info("nothing deleted")
+			return
+		}
+		for _, orphan := range orphans {
+			if err := ps.RemoveOrphan(orphan); err != nil {
+				log.Errorf("%s", err)
+				continue
+			}
+			log.Infof("deleted %s", orphan.Path)
+		}
+	},
+}
+
+func init() {
+	cleanCmd.Flags().Bool(
+		"dry-run",
+		false,
+		"Only list orphaned plugins",
+	)
+	cleanCmd.Flags().BoolP(
+		"yes",
+		"y",
+		false,
+		"Delete orphaned plugins without confirmation",
+	)
+
+	RootCmd.AddCommand(cleanCmd)
+}
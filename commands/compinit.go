@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// Use all files found in fpath without asking (`compinit -u`).
+	compinitModeUnsafe = "unsafe"
+	// Run compaudit and silently ignore insecure files and directories
+	// (`compinit -i`).
+	compinitModeSafe = "safe"
+)
+
+// defaultCompdumpFile is the location of the completion dump used when the
+// `compinit.dump_file` setting is empty. This is zsh code expanded by the shell
+// that sources the load script.
+const defaultCompdumpFile = `"${XDG_CACHE_HOME:-$HOME/.cache}/zpm/zcompdump-${ZSH_VERSION}"`
+
+type compinitArgs struct {
+	// Enabled is false when the user initializes the completion system by
+	// themselves.
+	Enabled bool
+	// Flags are passed to every `compinit` call.
+	Flags string
+	// DumpFile is the location of the completion dump file. If empty, the
+	// location is chosen by the load script.
+	DumpFile string
+	// Fingerprint identifies the set of fpath entries and installed plugin
+	// revisions the completion dump was generated for.
+	Fingerprint string
+}
+
+func makeCompinitArgs(plugins []pluginLoadArgs, revisions []string) (args compinitArgs, err error) {
+	args.Enabled = viper.GetBool(configKeyCompinitEnabled)
+	if !args.Enabled {
+		return args, nil
+	}
+
+	switch mode := viper.GetString(configKeyCompinitMode); mode {
+	case compinitModeUnsafe:
+		args.Flags = "-u"
+	case compinitModeSafe:
+		args.Flags = "-i"
+	default:
+		return args, fmt.Errorf("unknown compinit mode: %s", mode)
+	}
+
+	if dumpFile := viper.GetString(configKeyCompinitDumpFile); dumpFile != "" {
+		args.DumpFile, err = expandPath(dumpFile)
+		if err != nil {
+			return args, err
+		}
+	}
+
+	args.Fingerprint = compdumpFingerprint(plugins, revisions)
+
+	return args, nil
+}
+
+// compdumpFingerprint returns a hash that changes whenever the completion dump
+// must be regenerated. The fpath entries of conditional plugins are hashed
+// together with their conditions.
+func compdumpFingerprint(plugins []pluginLoadArgs, revisions []string) string {
+	hash := sha1.New()
+	for _, pluginArgs := range plugins {
+		for _, entry := range pluginArgs.Fpath {
+			if pluginArgs.Condition != "" {
+				entry += " if " + pluginArgs.Condition
+			}
+			_, _ = io.WriteString(hash, "fpath "+entry+"\n")
+		}
+	}
+	for _, revision := range revisions {
+		_, _ = io.WriteString(hash, "revision "+revision+"\n")
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// expandPath expands the home directory shortcut and environment variables in
+// the path provided by the user.
+func expandPath(path string) (string, error) {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := getHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return path, nil
+}
@@ -0,0 +1,159 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the configuration file parsed into YAML nodes. Unlike the
+// settings read by viper, the nodes keep comments and the order of keys, so
+// the file can be edited without rewriting what the user wrote.
+type configFile struct {
+	path     string
+	document yaml.Node
+}
+
+func readConfigFile(path string) (*configFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading the configuration file")
+	}
+	cf := &configFile{path: path}
+	if err := yaml.Unmarshal(data, &cf.document); err != nil {
+		return nil, errors.Wrap(err, "while parsing the configuration file")
+	}
+	// an empty file has no document at all
+	if cf.document.Kind == 0 {
+		cf.document = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+	}
+	if cf.document.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("the configuration file must contain a mapping")
+	}
+	return cf, nil
+}
+
+// plugins returns the sequence of the `plugins` key. The key is added when it
+// does not exist.
+func (cf *configFile) plugins() (*yaml.Node, error) {
+	mapping := cf.document.Content[0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != configKeyPlugins {
+			continue
+		}
+		value := mapping.Content[i+1]
+		if value.Tag == "!!null" {
+			*value = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		}
+		if value.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("%s must be a list", configKeyPlugins)
+		}
+		return value, nil
+	}
+
+	value := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	mapping.Content = append(
+		mapping.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: configKeyPlugins},
+		value,
+	)
+	return value, nil
+}
+
+// pluginSpecs returns the specs of the entries of the `plugins` sequence.
+// Entries are either spec strings or mappings with the `spec` key.
+func pluginSpecs(plugins *yaml.Node) []string {
+	specs := make([]string, 0, len(plugins.Content))
+	for _, entry := range plugins.Content {
+		spec := entry.Value
+		if entry.Kind == yaml.MappingNode {
+			spec = ""
+			for i := 0; i+1 < len(entry.Content); i += 2 {
+				if entry.Content[i].Value == "spec" {
+					spec = entry.Content[i+1].Value
+				}
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// write replaces the configuration file. The file is written to a temporary
+// file first, so it is never left half-written.
+func (cf *configFile) write() error {
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&cf.document); err != nil {
+		return errors.Wrap(err, "while serializing the configuration file")
+	}
+	if err := encoder.Close(); err != nil {
+		return errors.Wrap(err, "while serializing the configuration file")
+	}
+
+	mode := os.FileMode(0644)
+	if stat, err := os.Stat(cf.path); err == nil {
+		mode = stat.Mode()
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(cf.path), ".zpm.yaml.")
+	if err != nil {
+		return errors.Wrap(err, "while writing the configuration file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "while writing the configuration file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "while writing the configuration file")
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return errors.Wrap(err, "while writing the configuration file")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), cf.path), "while writing the configuration file")
+}
+
+// specWithoutVersion strips the required revision from a plugin spec.
+func specWithoutVersion(spec string) string {
+	return strings.SplitN(spec, "@", 2)[0]
+}
+
+// matchSpec tells whether a plugin spec is referred to by a command argument:
+// the spec itself, the spec without the version or the name of the plugin (the
+// last element of the spec).
+func matchSpec(spec string, arg string) bool {
+	name := specWithoutVersion(spec)
+	return spec == arg || name == arg || name[strings.LastIndex(name, "/")+1:] == arg
+}
+
+// findSpec returns the index of the only spec referred to by a command
+// argument.
+func findSpec(specs []string, arg string) (int, error) {
+	index := -1
+	for i, spec := range specs {
+		if spec == arg {
+			return i, nil
+		}
+		if !matchSpec(spec, arg) {
+			continue
+		}
+		if index >= 0 {
+			return -1, fmt.Errorf("%s matches both %s and %s, use the full spec", arg, specs[index], spec)
+		}
+		index = i
+	}
+	if index < 0 {
+		return -1, fmt.Errorf("plugin %s not listed in the configuration file", arg)
+	}
+	return index, nil
+}
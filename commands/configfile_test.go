@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const testConfigFile = `# zpm configuration
+logging_level: info
+plugins:
+  # the prompt goes first
+  - github.com/sindresorhus/pure@^1.0
+  - spec: github.com/zsh-users/zsh-autosuggestions
+    env:
+      ZSH_AUTOSUGGEST_USE_ASYNC: true # faster
+  - oh-my-zsh/plugin/git
+compinit:
+  enabled: true
+`
+
+// Feature: Editing the configuration file
+//   Scenario: Add and remove plugins
+//     Given a configuration file with comments
+//     When plugins are added and removed
+//     Then comments and the order of settings are preserved
+func TestConfigFileEdit(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, ".zpm.yaml")
+	require.Empty(t, ioutil.WriteFile(path, []byte(testConfigFile), 0600))
+
+	cf, err := readConfigFile(path)
+	require.Empty(t, err, "cannot read the configuration file")
+	plugins, err := cf.plugins()
+	require.Empty(t, err, "cannot find plugins")
+	specs := pluginSpecs(plugins)
+	assert.Equal(
+		t,
+		[]string{
+			"github.com/sindresorhus/pure@^1.0",
+			"github.com/zsh-users/zsh-autosuggestions",
+			"oh-my-zsh/plugin/git",
+		},
+		specs,
+	)
+
+	index, err := findSpec(specs, "zsh-autosuggestions")
+	require.Empty(t, err)
+	plugins.Content = append(plugins.Content[:index], plugins.Content[index+1:]...)
+	plugins.Content = append(plugins.Content, &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!str",
+		Value: "github.com/zsh-users/zsh-syntax-highlighting",
+	})
+	require.Empty(t, cf.write(), "cannot write the configuration file")
+
+	expected := `# zpm configuration
+logging_level: info
+plugins:
+  # the prompt goes first
+  - github.com/sindresorhus/pure@^1.0
+  - oh-my-zsh/plugin/git
+  - github.com/zsh-users/zsh-syntax-highlighting
+compinit:
+  enabled: true
+`
+	data, err := ioutil.ReadFile(path)
+	require.Empty(t, err)
+	assert.Equal(t, expected, string(data))
+
+	stat, err := os.Stat(path)
+	require.Empty(t, err)
+	assert.Equal(t, os.FileMode(0600), stat.Mode(), "the file mode must be preserved")
+}
+
+//   Scenario: Add the plugins key
+//     Given a configuration file without plugins
+//     When the plugins are requested
+//     Then an empty list is added
+func TestConfigFileNoPlugins(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, ".zpm.yaml")
+	require.Empty(t, ioutil.WriteFile(path, []byte("logging_level: info\n"), 0600))
+
+	cf, err := readConfigFile(path)
+	require.Empty(t, err, "cannot read the configuration file")
+	plugins, err := cf.plugins()
+	require.Empty(t, err, "cannot find plugins")
+	assert.Empty(t, pluginSpecs(plugins))
+}
+
+//   Scenario: Refer to plugins
+//     When a plugin is referred to by its spec, its spec without the version or its name
+//     Then the plugin is found
+//     And ambiguous names are rejected
+func TestFindSpec(t *testing.T) {
+	specs := []string{
+		"github.com/sindresorhus/pure@^1.0",
+		"github.com/user/git",
+		"oh-my-zsh/plugin/git",
+	}
+
+	cases := map[string]int{
+		"github.com/sindresorhus/pure@^1.0": 0,
+		"github.com/sindresorhus/pure":      0,
+		"pure":                              0,
+		"oh-my-zsh/plugin/git":              2,
+	}
+	for arg, expected := range cases {
+		index, err := findSpec(specs, arg)
+		assert.Empty(t, err, "cannot find %s", arg)
+		assert.Equal(t, expected, index, "invalid plugin found for %s", arg)
+	}
+
+	_, err := findSpec(specs, "git")
+	assert.NotEmpty(t, err, "ambiguous names must be rejected")
+	_, err = findSpec(specs, "zsh-async")
+	assert.NotEmpty(t, err, "missing plugins must be reported")
+}
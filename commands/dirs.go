@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Files of the state directory.
+const (
+	lastUpdateFileName    = ".lastupdate"
+	githubVersionFileName = ".github_version"
+)
+
+// xdgDir returns the zpm directory inside of the XDG base directory defined by
+// the environment variable. Relative paths are invalid according to the XDG
+// Base Directory Specification, so the default is used for them.
+func xdgDir(home string, env string, fallback string) string {
+	base := os.Getenv(env)
+	if !filepath.IsAbs(base) {
+		base = filepath.Join(home, fallback)
+	}
+	return filepath.Join(base, "zpm")
+}
+
+func defaultConfigFilePath(home string) string {
+	return filepath.Join(xdgDir(home, "XDG_CONFIG_HOME", ".config"), "config.yaml")
+}
+
+func defaultRootDir(home string) string {
+	return xdgDir(home, "XDG_DATA_HOME", ".local/share")
+}
+
+func defaultStateDir(home string) string {
+	return xdgDir(home, "XDG_STATE_HOME", ".local/state")
+}
+
+// resolveRootDir expands the configured plugin storage root. A relative root
+// is resolved against the base directory: the directory of the configuration
+// file for the setting and the working directory for the environment variable.
+func resolveRootDir(root string, baseDir string) (string, error) {
+	root, err := expandPath(root)
+	if err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(root) {
+		return root, nil
+	}
+	baseDir, err = filepath.Abs(baseDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(baseDir, root), nil
+}
+
+// migrate moves a file or a directory from a location used by older versions
+// of zpm unless the new location is already taken. Returns the location to
+// use, which is the old one when it cannot be moved.
+func migrate(from string, to string) string {
+	if _, err := os.Lstat(from); err != nil {
+		return to
+	}
+	if _, err := os.Lstat(to); err == nil {
+		log.Debugf("%s is not used since %s exists", from, to)
+		return to
+	}
+	err := os.MkdirAll(filepath.Dir(to), os.ModePerm)
+	if err == nil {
+		err = os.Rename(from, to)
+	}
+	if err != nil {
+		log.Errorf("%s", errors.Wrapf(err, "while moving %s to %s", from, to))
+		return from
+	}
+	log.Infof("moved %s to %s", from, to)
+	return to
+}
+
+// migrateStateFiles moves the files of the state directory out of the plugin
+// storage, where older versions of zpm kept them.
+func migrateStateFiles(root string, stateDir string) {
+	for _, name := range []string{lastUpdateFileName, githubVersionFileName} {
+		migrate(filepath.Join(root, name), filepath.Join(stateDir, name))
+	}
+}
@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Feature: XDG base directories
+//   Scenario: Resolve the directories
+//     Given XDG environment variables
+//     When the zpm directories are resolved
+//     Then relative base directories are ignored
+func TestXDGDir(t *testing.T) {
+	defer os.Setenv("XDG_DATA_HOME", os.Getenv("XDG_DATA_HOME"))
+
+	os.Setenv("XDG_DATA_HOME", "/data")
+	assert.Equal(t, "/data/zpm", defaultRootDir("/home/user"))
+	os.Setenv("XDG_DATA_HOME", "data")
+	assert.Equal(t, "/home/user/.local/share/zpm", defaultRootDir("/home/user"))
+	os.Setenv("XDG_DATA_HOME", "")
+	assert.Equal(t, "/home/user/.local/share/zpm", defaultRootDir("/home/user"))
+}
+
+//   Scenario: Migrate the old locations
+//     Given files in the locations of older versions of zpm
+//     When they are migrated
+//     Then they are moved unless the new locations are taken
+func TestMigrate(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	legacyRoot := filepath.Join(tempDir, ".zpm_plugins")
+	require.Empty(t, os.MkdirAll(filepath.Join(legacyRoot, "Plugins"), os.ModePerm))
+	require.Empty(t, ioutil.WriteFile(filepath.Join(legacyRoot, lastUpdateFileName), []byte("time"), 0600))
+
+	root := filepath.Join(tempDir, ".local/share/zpm")
+	assert.Equal(t, root, migrate(legacyRoot, root))
+	_, err = os.Stat(filepath.Join(root, "Plugins"))
+	assert.Empty(t, err, "the directory must be moved")
+	_, err = os.Stat(legacyRoot)
+	assert.True(t, os.IsNotExist(err), "the old directory must be deleted")
+
+	stateDir := filepath.Join(tempDir, ".local/state/zpm")
+	migrateStateFiles(root, stateDir)
+	data, err := ioutil.ReadFile(filepath.Join(stateDir, lastUpdateFileName))
+	assert.Empty(t, err, "the state files must be moved")
+	assert.Equal(t, "time", string(data))
+
+	legacyConfig := filepath.Join(tempDir, ".zpm.yaml")
+	config := filepath.Join(tempDir, ".config/zpm/config.yaml")
+	require.Empty(t, ioutil.WriteFile(legacyConfig, []byte("old"), 0600))
+	require.Empty(t, os.MkdirAll(filepath.Dir(config), os.ModePerm))
+	require.Empty(t, ioutil.WriteFile(config, []byte("new"), 0600))
+	assert.Equal(t, config, migrate(legacyConfig, config))
+	data, err = ioutil.ReadFile(config)
+	require.Empty(t, err)
+	assert.Equal(t, "new", string(data), "existing files must not be replaced")
+}
+
+//   Scenario: Resolve a relative storage root
+//     Given a relative storage root
+//     When the root is resolved
+//     Then it is relative to the base directory
+func TestResolveRootDir(t *testing.T) {
+	root, err := resolveRootDir("plugins", "/home/user/.config/zpm")
+	require.Empty(t, err, "cannot resolve the root")
+	assert.Equal(t, "/home/user/.config/zpm/plugins", root)
+
+	wd, err := os.Getwd()
+	require.Empty(t, err, "cannot get the working directory")
+	root, err = resolveRootDir("plugins", ".")
+	require.Empty(t, err, "cannot resolve the root")
+	assert.Equal(t, filepath.Join(wd, "plugins"), root, "the working directory must be used")
+
+	root, err = resolveRootDir("/srv/zpm", "/home/user/.config/zpm")
+	require.Empty(t, err, "cannot resolve the root")
+	assert.Equal(t, "/srv/zpm", root, "absolute roots must be kept")
+}
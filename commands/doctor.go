@@ -0,0 +1,397 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// The oldest zsh release the load script is tested with.
+const minimumZshVersion = "5.0"
+
+// Results of the checks of `zpm doctor`.
+const (
+	doctorOK      = "ok"
+	doctorWarning = "warning"
+	doctorError   = "error"
+	doctorFixed   = "fixed"
+)
+
+// compdumpLocationScript prints the location of the completion dump chosen by
+// the load script when the `compinit.dump_file` setting is empty.
+const compdumpLocationScript = `print -r -- ` + defaultCompdumpFile
+
+// compauditScript lists the insecure directories of fpath with the fpath
+// entries of the plugins passed as arguments.
+const compauditScript = `fpath=( "$@" $fpath )
+autoload -U compaudit
+compaudit 2>/dev/null`
+
+// doctor runs the checks of the installation and prints their results.
+type doctor struct {
+	out io.Writer
+	// Safe repairs are made when set.
+	fix bool
+	// The number of problems that are not fixed.
+	errors   int
+	warnings int
+}
+
+func (d *doctor) report(status string, format string, args ...interface{}) {
+	switch status {
+	case doctorError:
+		d.errors++
+	case doctorWarning:
+		d.warnings++
+	}
+	fmt.Fprintf(d.out, "%-9s %s\n", "["+status+"]", fmt.Sprintf(format, args...))
+}
+
+// parseZshVersion extracts the version from the output of `zsh --version`,
+// e.g. "zsh 5.8 (x86_64-apple-darwin19.0)".
+func parseZshVersion(output string) (string, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 2 || fields[0] != "zsh" {
+		return "", fmt.Errorf("unexpected output of zsh --version: %q", strings.TrimSpace(output))
+	}
+	return fields[1], nil
+}
+
+// versionAtLeast compares dotted versions. Non-numeric suffixes like "-dev"
+// are ignored.
+func versionAtLeast(version string, minimum string) bool {
+	parts := strings.Split(version, ".")
+	for i, minimumPart := range strings.Split(minimum, ".") {
+		if i >= len(parts) {
+			return false
+		}
+		digits := strings.IndexFunc(parts[i], func(r rune) bool {
+			return r < '0' || r > '9'
+		})
+		if digits >= 0 {
+			parts[i] = parts[i][:digits]
+		}
+		number, _ := strconv.Atoi(parts[i])
+		minimumNumber, _ := strconv.Atoi(minimumPart)
+		if number != minimumNumber {
+			return number > minimumNumber
+		}
+	}
+	return true
+}
+
+func (d *doctor) checkZsh() {
+	output, err := exec.Command("zsh", "--version").Output()
+	if err != nil {
+		d.report(doctorError, "cannot run zsh: %s", err)
+		return
+	}
+	version, err := parseZshVersion(string(output))
+	if err != nil {
+		d.report(doctorError, "%s", err)
+		return
+	}
+	if !versionAtLeast(version, minimumZshVersion) {
+		d.report(doctorWarning, "zsh %s is older than %s, the load script may not work", version, minimumZshVersion)
+		return
+	}
+	d.report(doctorOK, "zsh %s", version)
+}
+
+// checkBinary checks that `which zpm` in the load script and the background
+// update checks find this binary.
+func (d *doctor) checkBinary() {
+	found, err := exec.LookPath("zpm")
+	if err != nil {
+		d.report(doctorError, "zpm is not found in PATH, the load script cannot run it")
+		return
+	}
+	self, err := os.Executable()
+	if err != nil {
+		d.report(doctorWarning, "cannot find the running binary: %s", err)
+		return
+	}
+	foundResolved, errFound := filepath.EvalSymlinks(found)
+	selfResolved, errSelf := filepath.EvalSymlinks(self)
+	if errFound != nil || errSelf != nil || foundResolved != selfResolved {
+		d.report(doctorWarning, "zpm in PATH is %s, but %s is running", found, self)
+		return
+	}
+	d.report(doctorOK, "zpm in PATH is %s", found)
+}
+
+// checkConfig checks the parts of the configuration that are not validated
+// on startup. Returns nil when the plugin storage cannot be created.
+func (d *doctor) checkConfig() *plugin.PluginStorage {
+	cf, err := readConfigFile(configFilePath)
+	if err == nil {
+		_, err = cf.plugins()
+	}
+	if err != nil {
+		d.report(doctorError, "%s", err)
+		return nil
+	}
+	if _, err := plugin.MakePluginStorage(rootDir, pluginsConfigs); err != nil {
+		d.report(doctorError, "invalid plugins in %s: %s", configFilePath, err)
+		return nil
+	}
+	d.report(doctorOK, "configuration file %s", configFilePath)
+	return makePluginStorage()
+}
+
+func (d *doctor) checkRootDir() {
+	stat, err := os.Stat(rootDir)
+	if err != nil {
+		d.report(doctorError, "%s", err)
+		return
+	}
+	file, err := ioutil.TempFile(rootDir, ".zpm-doctor")
+	if err != nil {
+		d.report(doctorError, "the plugin storage %s is not writable: %s", rootDir, err)
+		return
+	}
+	file.Close()
+	os.Remove(file.Name())
+
+	mode := stat.Mode().Perm()
+	if mode&0022 == 0 {
+		d.report(doctorOK, "plugin storage %s", rootDir)
+		return
+	}
+	if !d.fix {
+		d.report(doctorWarning, "the plugin storage %s is writable by other users", rootDir)
+		return
+	}
+	if err := os.Chmod(rootDir, mode&^0022); err != nil {
+		d.report(doctorError, "while changing the permissions of %s: %s", rootDir, err)
+		return
+	}
+	d.report(doctorFixed, "the plugin storage %s is no longer writable by other users", rootDir)
+}
+
+// checkRepositories checks the integrity of the repositories of installed
+// plugins. Corrupted repositories are cloned again when fixing.
+func (d *doctor) checkRepositories(ps *plugin.PluginStorage) {
+	repositories, intact := 0, 0
+	for _, name := range ps.LoadOrder {
+		pse := ps.Plugins[name]
+		if pse.Directory() == "" {
+			continue
+		}
+		repositories++
+		err := pse.CheckIntegrity()
+		switch {
+		case err == plugin.NotInstalled:
+			d.report(doctorWarning, "%s is not installed, run `zpm install`", name)
+			continue
+		case err == nil:
+			intact++
+			continue
+		case !d.fix:
+			d.report(doctorError, "%s is corrupted: %s", name, err)
+			continue
+		}
+		if err := pse.Reinstall(); err != nil {
+			d.report(doctorError, "%s is corrupted and cannot be installed again: %s", name, err)
+			continue
+		}
+		d.report(doctorFixed, "%s is corrupted and was installed again", name)
+	}
+	d.report(doctorOK, "%d of %d plugin repositories are intact", intact, repositories)
+}
+
+// checkCompaudit finds the fpath entries compinit considers insecure. The
+// permissions of the insecure directories inside of the plugin storage are
+// fixed like compaudit suggests.
+func (d *doctor) checkCompaudit(args loadScriptArgs) {
+	if !args.Compinit.Enabled {
+		return
+	}
+	var fpath []string
+	for _, pluginArgs := range args.Plugins {
+		fpath = append(fpath, pluginArgs.Fpath...)
+	}
+	command := exec.Command("zsh", append([]string{"-f", "-c", compauditScript, "zsh"}, fpath...)...)
+	// compaudit exits with an error when insecure directories are found
+	output, err := command.Output()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		d.report(doctorError, "cannot run compaudit: %s", err)
+		return
+	}
+
+	insecure := 0
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		dir := strings.TrimSpace(scanner.Text())
+		if dir == "" {
+			continue
+		}
+		insecure++
+		inStorage := dir == rootDir || strings.HasPrefix(dir, rootDir+string(filepath.Separator))
+		if !d.fix || !inStorage {
+			d.report(doctorWarning, "%s is insecure, run `compaudit | xargs chmod g-w,o-w`", dir)
+			continue
+		}
+		stat, err := os.Stat(dir)
+		if err == nil {
+			err = os.Chmod(dir, stat.Mode().Perm()&^0022)
+		}
+		if err != nil {
+			d.report(doctorError, "while changing the permissions of %s: %s", dir, err)
+			continue
+		}
+		d.report(doctorFixed, "%s is no longer writable by other users", dir)
+	}
+	if insecure == 0 {
+		d.report(doctorOK, "no insecure completion directories")
+	}
+}
+
+// compdumpLocation returns the location of the completion dump used by the
+// load script.
+func compdumpLocation(args compinitArgs) (string, error) {
+	if args.DumpFile != "" {
+		return args.DumpFile, nil
+	}
+	output, err := exec.Command("zsh", "-f", "-c", compdumpLocationScript).Output()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the completion dump: %s", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// checkCompdump checks that the completion dump was generated for the current
+// fpath and plugin revisions. Stale dumps are deleted when fixing.
+func (d *doctor) checkCompdump(args compinitArgs) {
+	if !args.Enabled {
+		d.report(doctorOK, "the completion system is initialized outside of zpm")
+		return
+	}
+	dumpFile, err := compdumpLocation(args)
+	if err != nil {
+		d.report(doctorError, "%s", err)
+		return
+	}
+	if _, err := os.Stat(dumpFile); os.IsNotExist(err) {
+		d.report(doctorOK, "the completion dump %s is generated on the next shell start", dumpFile)
+		return
+	}
+	fingerprint, err := ioutil.ReadFile(dumpFile + ".zpm")
+	if err == nil && strings.TrimSpace(string(fingerprint)) == args.Fingerprint {
+		d.report(doctorOK, "the completion dump %s is up to date", dumpFile)
+		return
+	}
+	if !d.fix {
+		d.report(doctorWarning, "the completion dump %s is stale", dumpFile)
+		return
+	}
+	for _, path := range []string{dumpFile, dumpFile + ".zpm"} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			d.report(doctorError, "while deleting the stale completion dump: %s", err)
+			return
+		}
+	}
+	d.report(doctorFixed, "the stale completion dump %s was deleted", dumpFile)
+}
+
+// zshrcPath returns the location of .zshrc read by zsh.
+func zshrcPath() (string, error) {
+	if zdotdir := os.Getenv("ZDOTDIR"); zdotdir != "" {
+		return filepath.Join(zdotdir, ".zshrc"), nil
+	}
+	home, err := getHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".zshrc"), nil
+}
+
+// checkZshrc checks that a line of .zshrc that is not a comment loads zpm.
+func (d *doctor) checkZshrc(path string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		d.report(doctorError, "cannot read %s: %s", path, err)
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") && strings.Contains(line, "zpm load") {
+			d.report(doctorOK, "%s loads zpm", path)
+			return
+		}
+	}
+	d.report(doctorError, "%s does not load zpm, add `source <(zpm load)` to it", path)
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose the installation",
+	Long: `Diagnose the installation.
+
+The following is checked: the version of zsh, the zpm binary found in PATH, the
+configuration file, the permissions of the plugin storage, the integrity of the
+plugin repositories, insecure completion directories reported by compaudit, the
+completion dump and the line loading zpm in .zshrc.
+
+With --fix safe repairs are made: corrupted repositories are cloned again,
+stale completion dumps are deleted and the directories inside of the plugin
+storage are made writable only by their owner. The command exits with an error
+when problems remain.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fix, _ := cmd.Flags().GetBool("fix")
+		d := doctor{out: os.Stdout, fix: fix}
+
+		d.checkZsh()
+		d.checkBinary()
+		ps := d.checkConfig()
+		d.checkRootDir()
+		if ps != nil {
+			defer lockStorage(ps, fix)()
+			if fix {
+				defer handleInterrupts(ps)()
+			}
+			d.checkRepositories(ps)
+			loadArgs, err := makeLoadScriptArgs(ps)
+			if err != nil {
+				d.report(doctorError, "%s", err)
+			} else {
+				d.checkCompaudit(loadArgs)
+				d.checkCompdump(loadArgs.Compinit)
+			}
+		}
+		if path, err := zshrcPath(); err != nil {
+			d.report(doctorError, "%s", err)
+		} else {
+			d.checkZshrc(path)
+		}
+
+		if d.errors > 0 {
+			log.Fatalf("found %d errors and %d warnings", d.errors, d.warnings)
+		}
+		if d.warnings > 0 {
+			log.Warnf("found %d warnings", d.warnings)
+		}
+	},
+}
+
+func init() {
+	doctorCmd.Flags().Bool(
+		"fix",
+		false,
+		"Make safe repairs of the problems found",
+	)
+
+	RootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Feature: Diagnosing the installation
+//   Scenario: Check the zsh version
+//     When the output of zsh --version is parsed
+//     Then the version is compared with the minimum version
+func TestZshVersion(t *testing.T) {
+	version, err := parseZshVersion("zsh 5.8 (x86_64-apple-darwin19.0)\n")
+	require.Empty(t, err)
+	assert.Equal(t, "5.8", version)
+	_, err = parseZshVersion("bash: zsh: command not found")
+	assert.NotEmpty(t, err, "unexpected output must be rejected")
+
+	assert.True(t, versionAtLeast("5.8", "5.0"))
+	assert.True(t, versionAtLeast("5.0.2", "5.0"))
+	assert.True(t, versionAtLeast("5.9-dev-0", "5.9"))
+	assert.False(t, versionAtLeast("4.3.17", "5.0"))
+	assert.False(t, versionAtLeast("5", "5.0"))
+}
+
+//   Scenario: Fix a stale completion dump
+//     Given a completion dump generated for other plugins
+//     When the doctor fixes problems
+//     Then the completion dump is deleted
+func TestDoctorCompdump(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+	dumpFile := filepath.Join(tempDir, ".zcompdump")
+	require.Empty(t, ioutil.WriteFile(dumpFile, []byte("dump"), 0600))
+	require.Empty(t, ioutil.WriteFile(dumpFile+".zpm", []byte("old\n"), 0600))
+
+	args := compinitArgs{Enabled: true, DumpFile: dumpFile, Fingerprint: "new"}
+	var out bytes.Buffer
+	d := doctor{out: &out}
+	d.checkCompdump(args)
+	assert.Equal(t, 1, d.warnings, "the stale dump must be reported")
+
+	d = doctor{out: &out, fix: true}
+	d.checkCompdump(args)
+	assert.Equal(t, 0, d.warnings+d.errors, "the stale dump must be fixed")
+	_, err = os.Stat(dumpFile)
+	assert.True(t, os.IsNotExist(err), "the stale dump must be deleted")
+}
+
+//   Scenario: Check .zshrc
+//     Given .zshrc files with and without the zpm load line
+//     When .zshrc is checked
+//     Then commented out lines are not accepted
+func TestDoctorZshrc(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, ".zshrc")
+
+	cases := map[string]int{
+		"export EDITOR=vim\nsource <(zpm load)\n": 0,
+		"# source <(zpm load)\n":                  1,
+		"":                                        1,
+	}
+	for zshrc, errors := range cases {
+		require.Empty(t, ioutil.WriteFile(path, []byte(zshrc), 0600))
+		d := doctor{out: ioutil.Discard}
+		d.checkZshrc(path)
+		assert.Equal(t, errors, d.errors, "invalid result for %q", zshrc)
+	}
+}
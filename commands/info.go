@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// printDetails writes the details of a plugin as a list of fields. Empty
+// fields are omitted.
+func printDetails(w io.Writer, details plugin.PluginDetails) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	field := func(name string, value string) {
+		if value != "" {
+			fmt.Fprintf(tw, "%s:\t%s\n", name, value)
+		}
+	}
+
+	field("Name", details.Name)
+	field("Type", details.Type)
+	names := make([]string, 0, len(details.SpecFields))
+	for name := range details.SpecFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field("Spec "+name, details.SpecFields[name])
+	}
+	field("Path", details.Path)
+	field("Source", details.Source)
+	if details.RemoteURL != details.Source {
+		field("Remote URL", details.RemoteURL)
+	}
+	required := details.RequiredRevision
+	if details.ResolvedTag != "" {
+		required = fmt.Sprintf("%s (%s)", required, details.ResolvedTag)
+	}
+	field("Required revision", required)
+	field("Installed revision", details.InstalledRevision)
+	field("Target revision", details.TargetRevision)
+	if details.InstalledAt != nil {
+		field("Installed at", details.InstalledAt.Format(time.RFC1123))
+	}
+	if !details.LastFetch.IsZero() {
+		field("Last fetch", details.LastFetch.Format(time.RFC1123))
+	}
+	if details.LastCheck != nil {
+		field("Last check", details.LastCheck.Format(time.RFC1123))
+	}
+	state := details.State
+	if details.Frozen {
+		state += " (frozen after a rollback)"
+	}
+	field("State", state)
+	field("Error", details.Error)
+	field("Last error", details.LastError)
+	field("Load error", details.LoadError)
+	for i, entry := range details.History {
+		name := ""
+		if i == 0 {
+			name = "Replaced revisions"
+		}
+		fmt.Fprintf(tw, "%s\t%.7s at %s\n", name+":", entry.Revision, entry.Time.Format(time.RFC1123))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	section := func(name string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s:\n", name)
+		for _, line := range lines {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+	section("fpath", details.Fpath)
+	section("Load commands", details.Exec)
+	if details.Readme != "" {
+		section("README", []string{details.Readme})
+	}
+	return nil
+}
+
+var infoCmd = &cobra.Command{
+	Use:   "info <spec|name>",
+	Short: "Show everything about a plugin",
+	Long: `Show everything about a plugin: the parsed spec, the paths, the required,
+installed and target revisions, the commands executed when the plugin is loaded,
+the beginning of its README and errors.
+
+The plugin is checked against the installed repository without fetching it. Use
+` + "`zpm check`" + ` to find new updates.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ps := makePluginStorage()
+		defer lockStorage(ps, false)()
+		index, err := findSpec(ps.LoadOrder, args[0])
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		pse := ps.Plugins[ps.LoadOrder[index]]
+		pse.CheckPluginUpdate(true)
+
+		if err := printDetails(os.Stdout, pse.Details()); err != nil {
+			log.Fatalf("%s", err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(infoCmd)
+}
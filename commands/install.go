@@ -3,6 +3,8 @@ package commands
 import (
 	"github.com/eugene-babichenko/zpm/plugin"
 
+	"os"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -11,21 +13,51 @@ var installCmd = &cobra.Command{
 	Use:   "install",
 	Short: "Install new plugins",
 	Run: func(cmd *cobra.Command, args []string) {
-		log.Info("installing plugins...")
-		log.Info("not updating plugins! Run `zpm update` to do it.")
+		locked, _ := cmd.Flags().GetBool("locked")
+
+		ps := makePluginStorage()
+		defer lockStorage(ps, true)()
+		defer handleInterrupts(ps)()
+		defer startProgress(ps)()
+
+		if locked {
+			log.Infof("installing plugins locked in %s...", lockFilePath())
 
-		ps, err := plugin.MakePluginStorage(rootDir, pluginsSpecs)
-		if err != nil {
-			log.Fatalf("while reading plugin configurations: %s", err)
+			if _, err := os.Stat(lockFilePath()); os.IsNotExist(err) {
+				log.Fatalf("%s does not exist, run `zpm install` without --locked to create it", lockFilePath())
+			}
+			lock, err := plugin.ReadLock(lockFilePath())
+			if err != nil {
+				log.Fatalf("%s", err)
+			}
+			if err := ps.ApplyLock(lock); err != nil {
+				log.Fatalf("%s", err)
+			}
+
+			// installed plugins are moved to the locked revisions as well
+			ps.CheckPluginUpdates(false)
+			ps.InstallAll()
+			ps.UpdateAll()
+		} else {
+			log.Info("installing plugins...")
+			log.Info("not updating plugins! Run `zpm update` to do it.")
+
+			ps.CheckPluginInstalls()
+			ps.InstallAll()
 		}
 
-		ps.CheckPluginInstalls()
-		ps.InstallAll()
+		writeLock(ps)
 
 		log.Info("installation finished!")
 	},
 }
 
 func init() {
+	installCmd.Flags().Bool(
+		"locked",
+		false,
+		"Install and check out the exact revisions recorded in the lock file",
+	)
+
 	RootCmd.AddCommand(installCmd)
 }
@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// handleInterrupts cancels the operations of the plugin storage on the first
+// SIGINT or SIGTERM, so clones are removed from staging directories and
+// checkouts are finished before zpm exits. The second signal exits
+// immediately. The returned function stops handling signals and exits with an
+// error if zpm was interrupted.
+func handleInterrupts(ps *plugin.PluginStorage) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ps.Network.Context = ctx
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		log.Warn("interrupted, cleaning up (interrupt again to exit immediately)")
+		cancel()
+		select {
+		case <-signals:
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+		if ctx.Err() != nil {
+			log.Fatal("interrupted")
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	listFormatTable = "table"
+	listFormatJSON  = "json"
+	listFormatPlain = "plain"
+)
+
+// printList writes the descriptions of plugins in one of the list formats.
+func printList(w io.Writer, list []plugin.PluginInfo, format string) error {
+	switch format {
+	case listFormatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tTYPE\tSOURCE\tREVISION\tINSTALLED\tSTATE\tPATH")
+		for _, info := range list {
+			fmt.Fprintf(
+				tw,
+				"%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				info.Name,
+				info.Type,
+				orDash(info.Source),
+				orDash(info.RequiredRevision),
+				orDash(fmt.Sprintf("%.7s", info.InstalledRevision)),
+				info.State,
+				info.Path,
+			)
+		}
+		return tw.Flush()
+	case listFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(list)
+	case listFormatPlain:
+		// tab separated values without a header, with empty fields kept, for
+		// shell scripts
+		for _, info := range list {
+			fields := []string{
+				info.Name,
+				info.Type,
+				info.Source,
+				info.RequiredRevision,
+				info.InstalledRevision,
+				info.State,
+				info.Path,
+			}
+			if _, err := fmt.Fprintln(w, strings.Join(fields, "\t")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List configured plugins and their states",
+	Long: `List configured plugins and their states.
+
+The states are checked against the installed repositories without fetching
+them, so the command works offline. Use ` + "`zpm check`" + ` to find new updates.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		switch format {
+		case listFormatTable, listFormatJSON, listFormatPlain:
+		default:
+			log.Fatalf("unknown format %q", format)
+		}
+
+		ps := makePluginStorage()
+		defer lockStorage(ps, false)()
+		ps.CheckPluginUpdates(true)
+
+		if err := printList(os.Stdout, ps.List(), format); err != nil {
+			log.Fatalf("%s", err)
+		}
+	},
+}
+
+func init() {
+	listCmd.Flags().StringP(
+		"format",
+		"f",
+		listFormatTable,
+		"Output format: table, json or plain",
+	)
+
+	RootCmd.AddCommand(listCmd)
+}
@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testList = []plugin.PluginInfo{
+	{
+		Name:              "github.com/user/repo@^1.0",
+		Type:              "github",
+		Source:            "https://github.com/user/repo.git",
+		RequiredRevision:  "^1.0",
+		InstalledRevision: "0123456789abcdef0123456789abcdef01234567",
+		State:             plugin.StateInstalled,
+		Path:              "/home/user/.zpm_plugins/Plugins/github.com/user/repo",
+	},
+	{
+		Name:  "dir://local",
+		Type:  "dir",
+		State: plugin.StateError,
+		Error: "not found",
+		Path:  "/home/user/.zpm_plugins/Plugins/local",
+	},
+}
+
+// Feature: Listing plugins
+//   Scenario: Print a table
+func TestPrintListTable(t *testing.T) {
+	out := &bytes.Buffer{}
+	require.Empty(t, printList(out, testList, listFormatTable))
+	expected := "" +
+		"NAME                       TYPE    SOURCE                            REVISION  INSTALLED  STATE      PATH\n" +
+		"github.com/user/repo@^1.0  github  https://github.com/user/repo.git  ^1.0      0123456    installed  /home/user/.zpm_plugins/Plugins/github.com/user/repo\n" +
+		"dir://local                dir     -                                 -         -          error      /home/user/.zpm_plugins/Plugins/local\n"
+	assert.Equal(t, expected, out.String())
+}
+
+//   Scenario: Print machine-readable output
+//     When the list is printed as JSON or plain text
+//     Then full revisions are printed
+//     And empty fields are kept in plain text
+func TestPrintListMachineReadable(t *testing.T) {
+	out := &bytes.Buffer{}
+	require.Empty(t, printList(out, testList, listFormatJSON))
+	assert.Contains(t, out.String(), `"installed_revision": "0123456789abcdef0123456789abcdef01234567"`)
+	assert.Contains(t, out.String(), `"error": "not found"`)
+
+	out.Reset()
+	require.Empty(t, printList(out, testList, listFormatPlain))
+	expected := "" +
+		"github.com/user/repo@^1.0\tgithub\thttps://github.com/user/repo.git\t^1.0\t0123456789abcdef0123456789abcdef01234567\tinstalled\t/home/user/.zpm_plugins/Plugins/github.com/user/repo\n" +
+		"dir://local\tdir\t\t\t\terror\t/home/user/.zpm_plugins/Plugins/local\n"
+	assert.Equal(t, expected, out.String())
+
+	assert.NotEmpty(t, printList(out, testList, "yaml"), "unknown formats must be rejected")
+}
@@ -3,12 +3,10 @@ package commands
 import (
 	"github.com/eugene-babichenko/zpm/plugin"
 
-	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"text/template"
 	"time"
 
 	"github.com/pkg/errors"
@@ -17,64 +15,22 @@ import (
 	"github.com/spf13/viper"
 )
 
-type loadScriptArgs struct {
-	FpathEntries []string
-	LoadFiles    []string
-}
+// loadLockTimeout replaces the lock_timeout setting for `zpm load`.
+const loadLockTimeout = time.Second
 
-// Note the part I took from Oh My Zsh
-//Copyright (c) 2009-2019 Robby Russell and contributors
-//See the full list at https://github.com/robbyrussell/oh-my-zsh/contributors
-//
-//Permission is hereby granted, free of charge, to any person obtaining a copy
-//of this software and associated documentation files (the "Software"), to deal
-//in the Software without restriction, including without limitation the rights
-//to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
-//copies of the Software, and to permit persons to whom the Software is
-//furnished to do so, subject to the following conditions:
-//
-//The above copyright notice and this permission notice shall be included in all
-//copies or substantial portions of the Software.
-
-const loadScriptTemplate = `
-### TAKEN FROM OH MY ZSH
-
-# Figure out the SHORT hostname
-if [[ "$OSTYPE" = darwin* ]]; then
-	# macOS's $HOST changes with dhcp, etc. Use ComputerName if possible.
-	SHORT_HOST=$(scutil --get ComputerName 2>/dev/null) || SHORT_HOST=${HOST/.*/}
-else
-	SHORT_HOST=${HOST/.*/}
-fi
-ZSH_COMPDUMP=${ZDOTDIR:-${HOME}}/.zcompdump-${SHORT_HOST}-${ZSH_VERSION}
-
-### TAKEN FROM OH MY ZSH
-
-# initialize zsh completion system
-autoload -U compaudit compinit
-# load autocompletion scripts
-{{if .FpathEntries}}
-fpath=( {{range .FpathEntries}}{{.}} {{end}}$fpath )
-{{end}}
-compinit -u -C -d ${ZSH_COMPDUMP}
-# initialize plugins
-{{range .LoadFiles}}
-{{.}}{{end}}
-
-if [ -z "$ZPM_BINARY" ]; then
-	ZPM_BINARY=$(which zpm)
-fi
-zpm () {
-	$ZPM_BINARY $@
-	if [ "$1" = "update" ] || [ "$1" = "install" ]; then
-		echo "zpm: Loading updates..."
-		source <($ZPM_BINARY load)
-	fi
+// hasMissingPlugins tells whether any plugin can be installed, without
+// reporting the plugins.
+func hasMissingPlugins(ps *plugin.PluginStorage) bool {
+	for _, pse := range ps.Plugins {
+		if _, err := pse.Plugin.IsInstalled(); err == plugin.NotInstalled {
+			return true
+		}
+	}
+	return false
 }
-`
 
 func getLastUpdateTime() (t time.Time, err error) {
-	filename := filepath.Join(rootDir, ".lastupdate")
+	filename := filepath.Join(stateDir, lastUpdateFileName)
 	data, err := ioutil.ReadFile(filename)
 	if os.IsNotExist(err) {
 		return t, nil
@@ -107,19 +63,21 @@ var loadCmd = &cobra.Command{
 		updateCheck := viper.GetBool(configKeyOnLoadCheckForUpdates)
 		installMissing := viper.GetBool(configKeyOnLoadInstallMissingPlugins)
 
-		// Use different compdump for different zsh versions (kindly borrowed from Oh My Zsh).
-		fmt.Println("ZSH_COMPDUMP=\"${ZDOTDIR:-${HOME}}/.zcompdump-${SHORT_HOST}-${ZSH_VERSION}\"")
-		// initialize zsh completion system
-		fmt.Println("autoload -U compaudit compinit")
+		ps := makePluginStorage()
 
-		ps, err := plugin.MakePluginStorage(rootDir, pluginsSpecs)
+		// missing plugins are installed only with the exclusive lock, and the
+		// shell start must not wait for a long update in another terminal
+		lock, err := ps.LockStorage(installMissing && hasMissingPlugins(ps), loadLockTimeout)
 		if err != nil {
-			log.Fatalf("while reading plugin configurations: %s", err)
+			log.Warnf("%s, loading the installed plugins", err)
+			installMissing = false
+		} else {
+			defer lock.Unlock()
 		}
 
-		// check if there are downloaded updates
-		ps.CheckPluginUpdates(true)
-		currentVersion, err := ioutil.ReadFile(filepath.Join(rootDir, ".github_version"))
+		// the updates downloaded by the background check are recorded by it
+		ps.RestoreStates()
+		currentVersion, err := ioutil.ReadFile(filepath.Join(stateDir, githubVersionFileName))
 		if err != nil && !os.IsNotExist(err) {
 			log.Errorf("failed to read .github_version: %s", err)
 		} else if err == nil {
@@ -137,26 +95,12 @@ var loadCmd = &cobra.Command{
 			log.Info("To install new plugins, run `zpm install`")
 		}
 
-		pluginLoadData := loadScriptArgs{}
-
-		// plugin load order must be preserved because of dependencies between them
-		for _, name := range ps.LoadOrder {
-			pse := ps.Plugins[name]
-			fpathPlugin, execPlugin, err := pse.Plugin.Load()
-			if err != nil {
-				log.Errorf("while loading plugin %s: %s", pse.Name, err)
-				continue
-			}
-			pluginLoadData.FpathEntries = append(pluginLoadData.FpathEntries, fpathPlugin...)
-			pluginLoadData.LoadFiles = append(pluginLoadData.LoadFiles, execPlugin...)
-		}
-
-		tmpl, err := template.New("load").Parse(loadScriptTemplate)
+		pluginLoadData, err := makeLoadScriptArgs(ps)
 		if err != nil {
-			log.Fatalf("failed to parse the loader template: %s", err)
+			log.Fatalf("%s", err)
 		}
-		if err := tmpl.Execute(os.Stdout, pluginLoadData); err != nil {
-			log.Fatalf("failed to execute the loader template: %s", err)
+		if err := writeLoadScript(os.Stdout, pluginLoadData); err != nil {
+			log.Fatalf("%s", err)
 		}
 
 		if !updateCheck {
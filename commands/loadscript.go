@@ -0,0 +1,225 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+	"github.com/eugene-babichenko/zpm/zsh"
+
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// loadScriptArgs is the data passed to the load script template. This is a
+// part of the public interface: custom templates (see the `load_template`
+// setting) rely on it, so the fields must not be renamed or removed.
+type loadScriptArgs struct {
+	// FpathEntries are the fpath entries of all unconditional plugins.
+	FpathEntries []string
+	// Plugins are listed in the order they must be loaded in.
+	Plugins  []pluginLoadArgs
+	Compinit compinitArgs
+	// Standalone scripts do not rely on the zpm binary being available when
+	// they are sourced.
+	Standalone bool
+}
+
+// HasFpath tells whether any plugin has fpath entries.
+func (args loadScriptArgs) HasFpath() bool {
+	for _, pluginArgs := range args.Plugins {
+		if len(pluginArgs.Fpath) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// pluginLoadArgs contains the lines required to load a single plugin. All
+// lines are ready to be used as zsh code.
+type pluginLoadArgs struct {
+	// Name is the plugin spec as written in the configuration file.
+	Name string
+	// Condition is a zsh condition (e.g. `[[ $OSTYPE == darwin* ]]`) that must
+	// be true for the plugin to be loaded. Empty if the plugin is always loaded.
+	Condition string
+	// Fpath entries of the plugin. These are already included into
+	// `FpathEntries` unless the plugin has a condition.
+	Fpath []string
+	// Variable assignments and zstyle calls performed before the plugin is
+	// loaded.
+	Env    []string
+	Zstyle []string
+	Before string
+	Exec   []string
+	After  string
+}
+
+const loadScriptTemplate = `
+{{if .HasFpath}}
+# earlier plugins take precedence in fpath, conditional or not
+zpm_fpath=()
+{{range .Plugins}}{{if .Fpath}}{{if .Condition}}if {{.Condition}}; then
+	zpm_fpath+=( {{range .Fpath}}{{quote .}} {{end}})
+fi
+{{else}}zpm_fpath+=( {{range .Fpath}}{{quote .}} {{end}})
+{{end}}{{end}}{{end}}fpath=( $zpm_fpath $fpath )
+unset zpm_fpath
+{{end}}
+{{with .Compinit}}{{if .Enabled}}
+{{if .DumpFile}}
+ZSH_COMPDUMP={{quote .DumpFile}}
+{{else}}
+# the dump is resolved when the script is sourced, so bundles do not keep the
+# paths of the machine they were made on
+ZSH_COMPDUMP=` + defaultCompdumpFile + `
+[[ -d "${ZSH_COMPDUMP:h}" ]] || mkdir -p "${ZSH_COMPDUMP:h}"
+{{end}}
+# initialize zsh completion system
+autoload -U compaudit compinit
+# the cached dump is only trusted when it was generated for the same set of
+# completion sources, otherwise it is regenerated from scratch
+if [[ -s "${ZSH_COMPDUMP}" && -r "${ZSH_COMPDUMP}.zpm" && "$(<"${ZSH_COMPDUMP}.zpm")" == {{quote .Fingerprint}} ]]; then
+	compinit {{.Flags}} -C -d "${ZSH_COMPDUMP}"
+else
+	rm -f "${ZSH_COMPDUMP}"
+	compinit {{.Flags}} -d "${ZSH_COMPDUMP}"
+	echo {{quote .Fingerprint}} >| "${ZSH_COMPDUMP}.zpm"
+fi
+{{end}}{{end}}
+# initialize plugins
+{{range .Plugins}}
+{{comment .Name}}
+{{if .Condition}}if {{.Condition}}; then
+{{end}}{{range .Env}}{{.}}
+{{end}}{{range .Zstyle}}{{.}}
+{{end}}{{with .Before}}{{.}}
+{{end}}{{range .Exec}}{{.}}
+{{end}}{{with .After}}{{.}}
+{{end}}{{if .Condition}}fi
+{{end}}{{end}}{{if not .Standalone}}
+if [ -z "$ZPM_BINARY" ]; then
+	ZPM_BINARY=$(which zpm)
+fi
+zpm () {
+	"$ZPM_BINARY" "$@"
+	if [ "$1" = "update" ] || [ "$1" = "install" ]; then
+		echo "zpm: Loading updates..."
+		source <("$ZPM_BINARY" load)
+	fi
+}
+{{end}}`
+
+// loadScriptFuncs are available in the load script template to produce
+// shell-safe code from arbitrary values.
+var loadScriptFuncs = template.FuncMap{
+	"quote":   zsh.Quote,
+	"comment": zsh.Comment,
+}
+
+// makeLoadScriptArgs collects the data required to load all installed plugins
+// from the storage.
+func makeLoadScriptArgs(ps *plugin.PluginStorage) (args loadScriptArgs, err error) {
+	var revisions []string
+
+	// plugin load order must be preserved because of dependencies between them
+	for _, name := range ps.LoadOrder {
+		pse := ps.Plugins[name]
+		fpathPlugin, execPlugin, err := pse.Plugin.Load()
+		if err != nil {
+			log.Errorf("while loading plugin %s: %s", pse.Name, err)
+			continue
+		}
+		pluginArgs := makePluginLoadArgs(pse.Name, pse.Config, fpathPlugin, execPlugin)
+		if pluginArgs.Condition == "" {
+			args.FpathEntries = append(args.FpathEntries, fpathPlugin...)
+		}
+		args.Plugins = append(args.Plugins, pluginArgs)
+		if revision, err := pse.RecordedRevision(); err == nil {
+			revisions = append(revisions, revision)
+		}
+	}
+
+	args.Compinit, err = makeCompinitArgs(args.Plugins, revisions)
+	if err != nil {
+		return args, errors.Wrap(err, "invalid compinit configuration")
+	}
+
+	return args, nil
+}
+
+func makePluginLoadArgs(name string, config plugin.Config, fpath []string, exec []string) pluginLoadArgs {
+	args := pluginLoadArgs{
+		Name:      name,
+		Condition: strings.TrimSpace(config.Condition),
+		Fpath:     fpath,
+		Before:    strings.TrimSpace(config.Before),
+		Exec:      exec,
+		After:     strings.TrimSpace(config.After),
+	}
+
+	for _, variable := range config.Env {
+		if variable.Array {
+			args.Env = append(args.Env, zsh.Array(variable.Name, variable.Values))
+		} else {
+			args.Env = append(args.Env, zsh.Export(variable.Name, strings.Join(variable.Values, "")))
+		}
+	}
+
+	for _, zstyle := range config.Zstyle {
+		zstyleArgs := append([]string{"zstyle", zstyle.Context, zstyle.Style}, zstyle.Values...)
+		args.Zstyle = append(args.Zstyle, zsh.Command(zstyleArgs...))
+	}
+
+	return args
+}
+
+func renderLoadScript(w io.Writer, text string, args loadScriptArgs) error {
+	tmpl, err := template.New("load").Funcs(loadScriptFuncs).Parse(text)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse the loader template")
+	}
+	if err := tmpl.Execute(w, args); err != nil {
+		return errors.Wrap(err, "failed to execute the loader template")
+	}
+	return nil
+}
+
+// writeLoadScript renders the load script with the custom template if it is
+// configured. If the custom template cannot be rendered, the built-in one is
+// used, so a broken template does not leave the shell without plugins.
+func writeLoadScript(w io.Writer, args loadScriptArgs) error {
+	if templateFile := viper.GetString(configKeyLoadTemplate); templateFile != "" {
+		script, err := renderCustomLoadScript(templateFile, args)
+		if err == nil {
+			_, err = w.Write(script)
+			return err
+		}
+		log.Errorf("custom load script template %s: %s", templateFile, err)
+		log.Error("falling back to the built-in load script template")
+	}
+
+	return renderLoadScript(w, loadScriptTemplate, args)
+}
+
+func renderCustomLoadScript(templateFile string, args loadScriptArgs) ([]byte, error) {
+	templateFile, err := expandPath(templateFile)
+	if err != nil {
+		return nil, err
+	}
+	text, err := ioutil.ReadFile(templateFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the template")
+	}
+	// the script is rendered into a buffer to not output a partially rendered
+	// script if the template fails
+	var script bytes.Buffer
+	if err := renderLoadScript(&script, string(text), args); err != nil {
+		return nil, err
+	}
+	return script.Bytes(), nil
+}
@@ -0,0 +1,214 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+	"github.com/eugene-babichenko/zpm/zsh"
+
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+// checkGolden compares the output with testdata/<name>.golden. Run tests with
+// `-update` to regenerate golden files.
+func checkGolden(t *testing.T, name string, output []byte) {
+	golden := filepath.Join("testdata", name+".golden")
+	if *updateGolden {
+		err := ioutil.WriteFile(golden, output, 0644)
+		require.Empty(t, err, "cannot update the golden file")
+	}
+	expected, err := ioutil.ReadFile(golden)
+	require.Empty(t, err, "cannot read the golden file")
+	assert.Equal(t, string(expected), string(output), "output does not match "+golden)
+}
+
+// Feature: Load script generation
+//   Scenario: Unusual paths and values
+//     Given that paths and settings contain spaces, quotes and special characters
+//     When the load script is generated
+//     Then every value is quoted
+func TestLoadScriptUnusualPaths(t *testing.T) {
+	home := "/home/John O'Brien"
+	pluginDir := home + "/.zpm plugins/Plugins/github.com/user/$(rm -rf ~)"
+	themeDir := home + "/.zpm plugins/Plugins/[themes]*"
+
+	config := plugin.Config{
+		Spec: "github.com/user/repo",
+		Env: []plugin.Variable{
+			{Name: "STRATEGY", Values: []string{"history", "match prev cmd"}, Array: true},
+			{Name: "TOKEN", Values: []string{"`whoami`; echo it's"}},
+		},
+		Zstyle: []plugin.Zstyle{
+			{Context: ":completion:*", Style: "matcher-list", Values: []string{"m:{a-z}={A-Z}"}},
+		},
+		Before: "echo before",
+		After:  "echo after",
+	}
+
+	args := loadScriptArgs{
+		FpathEntries: []string{pluginDir, themeDir},
+		Plugins: []pluginLoadArgs{
+			makePluginLoadArgs("github.com/user/repo", config, []string{pluginDir}, []string{
+				zsh.Source(pluginDir + "/repo.plugin.zsh"),
+			}),
+			makePluginLoadArgs("dir://[themes]*\nrm -rf ~", plugin.Config{}, []string{themeDir}, []string{
+				zsh.Source(themeDir + "/it's a theme.zsh-theme"),
+			}),
+		},
+		Compinit: compinitArgs{
+			Enabled:  true,
+			Flags:    "-u",
+			DumpFile: home + "/.cache/zcompdump $ZSH_VERSION",
+		},
+	}
+	args.Compinit.Fingerprint = compdumpFingerprint(args.Plugins, nil)
+
+	var script bytes.Buffer
+	err := writeLoadScript(&script, args)
+	require.Empty(t, err, "cannot write the load script")
+	checkGolden(t, "unusual_paths", script.Bytes())
+}
+
+//   Scenario: Inline files with unusual paths
+//     Given that a sourced file has an unusual path
+//     When it is inlined into a bundle
+//     Then its contents replace the source line
+//     And $0 is set to the quoted path
+func TestInlineSourcedFilesUnusualPaths(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	pluginFile := filepath.Join(tempDir, "it's a $plugin.plugin.zsh")
+	err = ioutil.WriteFile(pluginFile, []byte("echo loaded"), 0644)
+	require.Empty(t, err, "cannot create a plugin file")
+
+	lines, err := inlineSourcedFiles([]string{"echo before", zsh.Source(pluginFile)})
+	require.Empty(t, err, "cannot inline files")
+
+	expected := []string{
+		"ZPM_BUNDLE_ARGZERO=$0",
+		"echo before",
+		zsh.Comment("inlined from " + pluginFile),
+		"0=" + zsh.Quote(pluginFile),
+		"echo loaded",
+		"0=$ZPM_BUNDLE_ARGZERO",
+		"unset ZPM_BUNDLE_ARGZERO",
+	}
+	assert.Equal(t, expected, lines, "invalid inlined lines")
+}
+
+//   Scenario: Conditional plugins
+//     Given that a plugin has a condition
+//     When the load script is generated
+//     Then its fpath entries and exec lines are wrapped with the condition
+//     And the fpath entries keep the load order
+func TestLoadScriptCondition(t *testing.T) {
+	config := plugin.Config{Spec: "dir://mac", Condition: "[[ $OSTYPE == darwin* ]]"}
+
+	args := loadScriptArgs{
+		FpathEntries: []string{"/plugins/always", "/plugins/last"},
+		Plugins: []pluginLoadArgs{
+			makePluginLoadArgs("dir://always", plugin.Config{}, []string{"/plugins/always"}, []string{
+				zsh.Source("/plugins/always/always.plugin.zsh"),
+			}),
+			makePluginLoadArgs("dir://mac", config, []string{"/plugins/mac"}, []string{
+				zsh.Source("/plugins/mac/mac.plugin.zsh"),
+			}),
+			makePluginLoadArgs("dir://last", plugin.Config{}, []string{"/plugins/last"}, []string{
+				zsh.Source("/plugins/last/last.plugin.zsh"),
+			}),
+		},
+		Standalone: true,
+	}
+
+	var script bytes.Buffer
+	err := writeLoadScript(&script, args)
+	require.Empty(t, err, "cannot write the load script")
+	checkGolden(t, "condition", script.Bytes())
+}
+
+//   Scenario: Default completion dump
+//     Given that the dump file is not configured
+//     When the load script is generated
+//     Then the dump location is resolved by the shell
+func TestLoadScriptDefaultDumpFile(t *testing.T) {
+	args := loadScriptArgs{
+		Compinit:   compinitArgs{Enabled: true, Flags: "-u", Fingerprint: "fingerprint"},
+		Standalone: true,
+	}
+
+	var script bytes.Buffer
+	err := writeLoadScript(&script, args)
+	require.Empty(t, err, "cannot write the load script")
+	assert.Contains(t, script.String(), "\nZSH_COMPDUMP="+defaultCompdumpFile+"\n", "invalid dump location")
+}
+
+// Feature: Custom load script templates
+//   Scenario: Valid template
+//     Given that a custom template is configured
+//     When the load script is generated
+//     Then the custom template is used
+func TestLoadScriptCustomTemplate(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	templateFile := filepath.Join(tempDir, "load.tmpl")
+	text := "{{range .Plugins}}{{comment .Name}}\n{{range .Exec}}{{.}}\n{{end}}{{end}}"
+	err = ioutil.WriteFile(templateFile, []byte(text), 0644)
+	require.Empty(t, err, "cannot write the template")
+
+	viper.Set(configKeyLoadTemplate, templateFile)
+	defer viper.Set(configKeyLoadTemplate, "")
+
+	args := loadScriptArgs{
+		Plugins: []pluginLoadArgs{
+			makePluginLoadArgs("dir://a b", plugin.Config{}, nil, []string{zsh.Source("/a b/a.plugin.zsh")}),
+		},
+	}
+
+	var script bytes.Buffer
+	err = writeLoadScript(&script, args)
+	require.Empty(t, err, "cannot write the load script")
+	assert.Equal(t, "# dir://a b\nsource '/a b/a.plugin.zsh'\n", script.String(), "invalid load script")
+}
+
+//   Scenario: Broken template
+//     Given that a custom template cannot be rendered
+//     When the load script is generated
+//     Then the built-in template is used
+func TestLoadScriptCustomTemplateFallback(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	templateFile := filepath.Join(tempDir, "load.tmpl")
+	err = ioutil.WriteFile(templateFile, []byte("{{range .Plugins}}{{.Unknown}}{{end}}"), 0644)
+	require.Empty(t, err, "cannot write the template")
+
+	args := loadScriptArgs{
+		Plugins: []pluginLoadArgs{
+			makePluginLoadArgs("dir://a", plugin.Config{}, nil, []string{zsh.Source("/a/a.plugin.zsh")}),
+		},
+	}
+
+	var expected bytes.Buffer
+	err = writeLoadScript(&expected, args)
+	require.Empty(t, err, "cannot write the load script")
+
+	for _, file := range []string{templateFile, filepath.Join(tempDir, "missing.tmpl")} {
+		viper.Set(configKeyLoadTemplate, file)
+
+		var script bytes.Buffer
+		err = writeLoadScript(&script, args)
+		require.Empty(t, err, "must fall back to the built-in template")
+		assert.Equal(t, expected.String(), script.String(), "must use the built-in template")
+	}
+	viper.Set(configKeyLoadTemplate, "")
+}
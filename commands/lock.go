@@ -0,0 +1,23 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// lockFilePath returns the location of the lock file, which is stored next to
+// the configuration file.
+func lockFilePath() string {
+	return filepath.Join(filepath.Dir(configFilePath), "zpm.lock")
+}
+
+// writeLock records the revisions of installed plugins into the lock file.
+func writeLock(ps *plugin.PluginStorage) {
+	if err := ps.MakeLock().Write(lockFilePath()); err != nil {
+		log.Errorf("%s", err)
+		log.Error("note that the lock file does not reflect installed plugins")
+	}
+}
@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of `zpm outdated`. Errors without available updates exit with 1.
+const (
+	// Updates are available.
+	outdatedExitCode = 2
+	// Updates are available, but some plugins cannot be checked.
+	outdatedPartialExitCode = 3
+)
+
+// formatAge formats the time passed since a commit for humans.
+func formatAge(age time.Duration) string {
+	switch {
+	case age < time.Hour:
+		return fmt.Sprintf("%d minutes", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%d hours", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%d days", int(age.Hours()/24))
+	}
+}
+
+// printOutdated writes the available updates as a table or as JSON. The ages
+// of the newest commits are counted from `now`.
+func printOutdated(w io.Writer, list []plugin.Outdated, format string, now time.Time) error {
+	switch format {
+	case listFormatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tCURRENT\tTARGET\tBEHIND\tNEWEST COMMIT")
+		for _, entry := range list {
+			behind, age := "-", "-"
+			if entry.Target != "" {
+				behind = fmt.Sprintf("%d", entry.Behind)
+				if !entry.FastForward {
+					behind += " (not fast-forward)"
+				}
+			}
+			if entry.NewestCommit != nil {
+				age = formatAge(now.Sub(*entry.NewestCommit)) + " ago"
+			}
+			fmt.Fprintf(
+				tw,
+				"%s\t%s\t%s\t%s\t%s\n",
+				entry.Name,
+				orDash(fmt.Sprintf("%.7s", entry.Current)),
+				orDash(fmt.Sprintf("%.7s", entry.Target)),
+				behind,
+				age,
+			)
+		}
+		return tw.Flush()
+	case listFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(list)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// findOutdated checks the plugins for updates. Returns the updates and the
+// number of plugins that cannot be checked.
+func findOutdated(offline bool) ([]plugin.Outdated, int) {
+	ps := makePluginStorage()
+	defer lockStorage(ps, !offline)()
+	if !offline {
+		defer handleInterrupts(ps)()
+		defer startProgress(ps)()
+	}
+
+	ps.CheckPluginUpdates(offline)
+	failed := 0
+	for _, info := range ps.List() {
+		if info.State == plugin.StateError {
+			failed++
+		}
+	}
+
+	return ps.Outdated(), failed
+}
+
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "List plugins with available updates",
+	Long: `List plugins with available updates.
+
+Every plugin with an available update is listed with the installed and target
+commits, the number of commits behind and the age of the newest commit. The
+repositories are fetched first unless --offline is set, in which case the data
+fetched by the last check or update is used.
+
+The command exits with 2 if there are updates, with 3 if there are updates
+but some plugins cannot be checked, with 1 if there are no updates and some
+plugins cannot be checked and with 0 otherwise.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		offline, _ := cmd.Flags().GetBool("offline")
+		switch format {
+		case listFormatTable, listFormatJSON:
+		default:
+			log.Fatalf("unknown format %q", format)
+		}
+
+		list, failed := findOutdated(offline)
+		if err := printOutdated(os.Stdout, list, format, time.Now()); err != nil {
+			log.Fatalf("%s", err)
+		}
+		switch {
+		case failed > 0 && len(list) > 0:
+			log.Errorf("cannot check %d plugins", failed)
+			os.Exit(outdatedPartialExitCode)
+		case failed > 0:
+			log.Fatalf("cannot check %d plugins", failed)
+		case len(list) > 0:
+			os.Exit(outdatedExitCode)
+		}
+	},
+}
+
+func init() {
+	outdatedCmd.Flags().StringP(
+		"format",
+		"f",
+		listFormatTable,
+		"Output format: table or json",
+	)
+	outdatedCmd.Flags().Bool(
+		"offline",
+		false,
+		"Use the data fetched by the last check instead of fetching",
+	)
+
+	RootCmd.AddCommand(outdatedCmd)
+}
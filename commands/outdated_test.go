@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testNow = time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+
+var testNewestCommit = testNow.Add(-3 * 24 * time.Hour)
+
+var testOutdated = []plugin.Outdated{
+	{
+		Name:         "github.com/user/repo",
+		Current:      "0123456789abcdef0123456789abcdef01234567",
+		Target:       "89abcdef0123456789abcdef0123456789abcdef",
+		Behind:       4,
+		NewestCommit: &testNewestCommit,
+		FastForward:  true,
+	},
+	{
+		Name:    "github.com/user/other@^1.0",
+		Current: "fedcba9876543210fedcba9876543210fedcba98",
+	},
+}
+
+// Feature: Listing outdated plugins
+//   Scenario: Print a table
+//     Given a plugin with a known update
+//     And a plugin with an update that is not known yet
+//     When the updates are printed as a table
+//     Then unknown fields are printed as dashes
+func TestPrintOutdatedTable(t *testing.T) {
+	out := &bytes.Buffer{}
+	require.Empty(t, printOutdated(out, testOutdated, listFormatTable, testNow))
+	expected := "" +
+		"NAME                        CURRENT  TARGET   BEHIND  NEWEST COMMIT\n" +
+		"github.com/user/repo        0123456  89abcde  4       3 days ago\n" +
+		"github.com/user/other@^1.0  fedcba9  -        -       -\n"
+	assert.Equal(t, expected, out.String())
+}
+
+//   Scenario: Print JSON
+func TestPrintOutdatedJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	require.Empty(t, printOutdated(out, testOutdated, listFormatJSON, testNow))
+	assert.Contains(t, out.String(), `"target": "89abcdef0123456789abcdef0123456789abcdef"`)
+	assert.Contains(t, out.String(), `"behind": 4`)
+	assert.Contains(t, out.String(), `"newest_commit": "2020-01-07T12:00:00Z"`)
+
+	out.Reset()
+	require.Empty(t, printOutdated(out, []plugin.Outdated{}, listFormatJSON, testNow))
+	assert.Equal(t, "[]\n", out.String(), "no updates must be an empty list")
+
+	assert.NotEmpty(t, printOutdated(out, testOutdated, "yaml", testNow), "unknown formats must be rejected")
+}
+
+//   Scenario: Format the age of commits
+func TestFormatAge(t *testing.T) {
+	assert.Equal(t, "45 minutes", formatAge(45*time.Minute))
+	assert.Equal(t, "5 hours", formatAge(5*time.Hour+30*time.Minute))
+	assert.Equal(t, "3 days", formatAge(80*time.Hour))
+}
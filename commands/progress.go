@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// The minimal period between redraws caused by progress messages of remotes.
+const progressRedrawPeriod = 100 * time.Millisecond
+
+// progressView shows a line with the current phase of every plugin being
+// checked or installed and redraws the lines in place. Log lines are printed
+// above the progress lines.
+type progressView struct {
+	mutex    sync.Mutex
+	out      io.Writer
+	width    int
+	names    []string
+	phases   map[string]string
+	lines    map[string]string
+	drawn    int
+	lastDraw time.Time
+	// the incomplete log line
+	buffer []byte
+}
+
+func newProgressView(out io.Writer, width int) *progressView {
+	return &progressView{
+		out:    out,
+		width:  width,
+		phases: make(map[string]string),
+		lines:  make(map[string]string),
+	}
+}
+
+func (v *progressView) Phase(name string, phase string, detail string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	line := phase
+	if detail != "" {
+		line = fmt.Sprintf("%s: %s", phase, detail)
+	}
+	if _, ok := v.lines[name]; !ok {
+		v.names = append(v.names, name)
+	}
+	samePhase := v.phases[name] == phase
+	v.phases[name] = phase
+	v.lines[name] = line
+
+	// progress messages of remotes come too often to redraw on every one
+	if samePhase && time.Since(v.lastDraw) < progressRedrawPeriod {
+		return
+	}
+	v.redraw()
+}
+
+func (v *progressView) Finish(name string, result string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	// plugins without network operations (like local directories) are not
+	// shown at all
+	if _, ok := v.lines[name]; !ok {
+		return
+	}
+	v.phases[name] = ""
+	v.lines[name] = result
+	v.redraw()
+}
+
+// Write prints log lines above the progress lines.
+func (v *progressView) Write(p []byte) (int, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.buffer = append(v.buffer, p...)
+	end := bytes.LastIndexByte(v.buffer, '\n')
+	if end < 0 {
+		return len(p), nil
+	}
+
+	v.clear()
+	if _, err := v.out.Write(v.buffer[:end+1]); err != nil {
+		return 0, err
+	}
+	v.buffer = v.buffer[end+1:]
+	v.draw()
+	return len(p), nil
+}
+
+func (v *progressView) redraw() {
+	v.clear()
+	v.draw()
+}
+
+// clear removes the progress lines, so the cursor is at the line where they
+// started.
+func (v *progressView) clear() {
+	for ; v.drawn > 0; v.drawn-- {
+		fmt.Fprint(v.out, "\x1b[1A\x1b[2K")
+	}
+}
+
+func (v *progressView) draw() {
+	for _, name := range v.names {
+		line := []rune(fmt.Sprintf("%s: %s", name, v.lines[name]))
+		// wrapped lines cannot be cleared
+		if v.width > 1 && len(line) >= v.width {
+			line = append(line[:v.width-4], []rune("...")...)
+		}
+		fmt.Fprintf(v.out, "%s\n", string(line))
+	}
+	v.drawn = len(v.names)
+	v.lastDraw = time.Now()
+}
+
+// progressLog reports the phases of plugin operations as log lines when the
+// progress cannot be redrawn in place.
+type progressLog struct {
+	mutex  sync.Mutex
+	phases map[string]string
+}
+
+func (p *progressLog) Phase(name string, phase string, _ string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.phases[name] == phase {
+		return
+	}
+	p.phases[name] = phase
+	log.Infof("%s: %s", name, phase)
+}
+
+// Finish does nothing, because the results are logged by the plugin storage.
+func (p *progressLog) Finish(string, string) {}
+
+// startProgress makes the plugin storage report the progress of operations: as
+// a live view on interactive terminals or as log lines otherwise, e.g. when
+// the output is redirected or in the background update check started by
+// `zpm load`, which has no terminal attached. The returned function must be
+// called when the operations are finished.
+func startProgress(ps *plugin.PluginStorage) (stop func()) {
+	fd := int(os.Stderr.Fd())
+	if !terminal.IsTerminal(fd) || os.Getenv("TERM") == "dumb" {
+		ps.Progress = &progressLog{phases: make(map[string]string)}
+		return func() {}
+	}
+
+	width, _, err := terminal.GetSize(fd)
+	if err != nil {
+		width = 80
+	}
+	view := newProgressView(os.Stderr, width)
+	ps.Progress = view
+	logOutput = view
+	return func() {
+		logOutput = os.Stderr
+	}
+}
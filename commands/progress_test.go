@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Progress display
+//   Scenario: Redraw progress lines in place
+//     Given that plugins report their phases
+//     When a log line is written
+//     Then it is printed above the progress lines
+//     And the progress lines are redrawn
+func TestProgressView(t *testing.T) {
+	out := &bytes.Buffer{}
+	view := newProgressView(out, 40)
+
+	view.Phase("github.com/user/repo", "fetching", "")
+	assert.Equal(t, "github.com/user/repo: fetching\n", out.String())
+
+	out.Reset()
+	view.Phase("github.com/user/other-repository", "cloning", "Counting objects: 100% (22/22)")
+	expected := "\x1b[1A\x1b[2K" +
+		"github.com/user/repo: fetching\n" +
+		"github.com/user/other-repository: cl...\n"
+	assert.Equal(t, expected, out.String(), "long lines must be truncated")
+
+	out.Reset()
+	view.Write([]byte("zpm: "))
+	assert.Empty(t, out.String(), "incomplete log lines must be buffered")
+	view.Write([]byte("installed\n"))
+	expected = "\x1b[1A\x1b[2K\x1b[1A\x1b[2K" +
+		"zpm: installed\n" +
+		"github.com/user/repo: fetching\n" +
+		"github.com/user/other-repository: cl...\n"
+	assert.Equal(t, expected, out.String(), "log lines must be printed above")
+
+	out.Reset()
+	view.Finish("dir://plugin", "up to date")
+	assert.Empty(t, out.String(), "plugins without phases must not be shown")
+}
@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var removeCmd = &cobra.Command{
+	Use:   "remove <spec|name>",
+	Short: "Remove a plugin from the configuration file",
+	Long: `Remove a plugin from the configuration file.
+
+The plugin can be referred to by its spec with or without the version or by its
+name (the last element of the spec). Comments and the order of settings in the
+configuration file are preserved. The files of the plugin are kept unless
+--purge is set.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		purge, _ := cmd.Flags().GetBool("purge")
+
+		cf, err := readConfigFile(configFilePath)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		plugins, err := cf.plugins()
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		specs := pluginSpecs(plugins)
+		index, err := findSpec(specs, args[0])
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		spec := specs[index]
+
+		oldPs := makePluginStorage()
+		defer lockStorage(oldPs, purge)()
+
+		plugins.Content = append(plugins.Content[:index], plugins.Content[index+1:]...)
+		if err := cf.write(); err != nil {
+			log.Fatalf("%s", err)
+		}
+		log.Infof("removed %s from %s", spec, configFilePath)
+
+		configs := make([]plugin.Config, 0, len(pluginsConfigs))
+		for _, config := range pluginsConfigs {
+			if config.Spec != spec {
+				configs = append(configs, config)
+			}
+		}
+		pluginsConfigs = configs
+		ps := makePluginStorage()
+		writeLock(ps)
+		oldPs.Plugins[spec].Forget()
+
+		if !purge {
+			return
+		}
+		// plugins that are no longer required, like Oh My Zsh after its last
+		// plugin is removed, are deleted as well
+		required := make(map[string]bool)
+		for _, pse := range ps.Plugins {
+			required[pse.Directory()] = true
+		}
+		for _, pse := range oldPs.Plugins {
+			dir := pse.Directory()
+			if dir == "" || required[dir] {
+				continue
+			}
+			if _, err := os.Stat(dir); os.IsNotExist(err) {
+				continue
+			}
+			if err := os.RemoveAll(dir); err != nil {
+				log.Errorf("while deleting %s: %s", pse.Name, err)
+				continue
+			}
+			log.Infof("deleted %s", dir)
+			pse.Forget()
+		}
+	},
+}
+
+func init() {
+	removeCmd.Flags().Bool(
+		"purge",
+		false,
+		"Delete the files of the plugin",
+	)
+
+	RootCmd.AddCommand(removeCmd)
+}
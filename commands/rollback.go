@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// parseRollbackTarget tells whether `--to` is a number of steps or a revision.
+// Abbreviated commit hashes are at least 7 characters long, so shorter numbers
+// are treated as steps.
+func parseRollbackTarget(to string) (steps int, revision string) {
+	if to == "" {
+		return 1, ""
+	}
+	if n, err := strconv.Atoi(to); err == nil && len(to) < 7 {
+		return n, ""
+	}
+	return 0, to
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [plugin]",
+	Short: "Restore plugin revisions installed before updates",
+	Long: `Restore plugin revisions installed before updates.
+
+Without arguments the last update of every plugin is rolled back. Rolled back
+plugins are frozen: they are not updated until they are updated explicitly with
+` + "`zpm update --plugin <plugin>`" + `.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		to, _ := cmd.Flags().GetString("to")
+		steps, revision := parseRollbackTarget(to)
+
+		ps := makePluginStorage()
+		defer lockStorage(ps, true)()
+
+		var names []string
+		if len(args) == 1 {
+			if _, ok := ps.Plugins[args[0]]; !ok {
+				log.Fatalf("plugin %s not listed in the configuration file", args[0])
+			}
+			names = []string{args[0]}
+		} else {
+			if revision != "" {
+				log.Fatal("a revision can only be specified for a single plugin")
+			}
+			for _, name := range ps.LoadOrder {
+				if len(ps.Plugins[name].History()) > 0 {
+					names = append(names, name)
+				}
+			}
+		}
+
+		if len(names) == 0 {
+			log.Info("no updates to roll back")
+			return
+		}
+
+		for _, name := range names {
+			pse := ps.Plugins[name]
+			var err error
+			if revision != "" {
+				err = pse.RollbackTo(revision)
+			} else {
+				err = pse.Rollback(steps)
+			}
+			if err != nil {
+				log.Errorf("%s", err)
+				continue
+			}
+			installed, _ := pse.Revision()
+			log.Infof("rolled back %s to %.7s", pse.Name, installed)
+			log.Infof("%s will not be updated until you run `zpm update --plugin %s`", pse.Name, pse.Name)
+		}
+
+		writeLock(ps)
+	},
+}
+
+func init() {
+	rollbackCmd.Flags().String(
+		"to",
+		"",
+		"The number of updates to roll back or a revision to restore (default: 1)",
+	)
+
+	RootCmd.AddCommand(rollbackCmd)
+}
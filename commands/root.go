@@ -1,12 +1,16 @@
 package commands
 
 import (
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
@@ -20,15 +24,40 @@ const (
 	configKeyOnLoadInstallMissingPlugins = "on_load.install_missing_plugins"
 	configKeyOnLoadCheckForUpdates       = "on_load.check_for_updates"
 	configKeyOnLoadUpdateCheckPeriod     = "on_load.update_check_period"
+	configKeyCompinitEnabled             = "compinit.enabled"
+	configKeyCompinitMode                = "compinit.mode"
+	configKeyCompinitDumpFile            = "compinit.dump_file"
+	configKeyLoadTemplate                = "load_template"
+	configKeyLocalChanges                = "local_changes"
+	configKeyJobs                        = "jobs"
+	configKeyNetworkTimeout              = "network.timeout"
+	configKeyNetworkRetries              = "network.retries"
+	configKeyAuth                        = "auth"
+	configKeyKeyring                     = "keyring"
+	configKeyRootDir                     = "root_dir"
+	configKeyLockTimeout                 = "lock_timeout"
+
+	// rootDirEnv overrides the root_dir setting.
+	rootDirEnv = "ZPM_ROOT"
 )
 
 var (
 	Version string
 
-	appConfigFile     string
-	rootDir           string
-	pluginsSpecs      []string
+	appConfigFile  string
+	configFilePath string
+	rootDir        string
+	// stateDir keeps the times of update checks and the latest zpm version.
+	stateDir          string
+	pluginsConfigs    []plugin.Config
 	updateCheckPeriod time.Duration
+	// what happens to local changes of plugins on update
+	localChangesPolicy plugin.LocalChangesPolicy
+	networkOptions     plugin.NetworkOptions
+	authOptions        plugin.AuthOptions
+	keyringPath        string
+	// how long commands wait for other zpm processes using the plugin storage
+	lockTimeout time.Duration
 
 	RootCmd = &cobra.Command{
 		Use:   "zpm [command]",
@@ -49,10 +78,14 @@ func init() {
 		&appConfigFile,
 		"config",
 		"",
-		"Config file location (default: $HOME/.zpm.yaml)",
+		"Config file location (default: $XDG_CONFIG_HOME/zpm/config.yaml)",
 	)
 }
 
+// logOutput is where log lines are written. The progress view replaces it to
+// keep log lines above the progress lines.
+var logOutput io.Writer = os.Stderr
+
 // prefixedWriter allows to add "zsh: " between log lines
 type prefixedWriter struct{}
 
@@ -60,11 +93,11 @@ func (prefixedWriter) Write(p []byte) (n int, err error) {
 	// Writing logs to stderr is workaround. In `source <(zpm load)` the
 	// `<(...)` consumes only what is written to stdout. Thus, writing logs to
 	// stderr allows us to have nice logs while loading plugins.
-	nPrefix, err := os.Stderr.Write([]byte("zpm: "))
+	nPrefix, err := logOutput.Write([]byte("zpm: "))
 	if err != nil {
 		return nPrefix, err
 	}
-	np, err := os.Stderr.Write(p)
+	np, err := logOutput.Write(p)
 	return nPrefix + np, err
 }
 
@@ -97,39 +130,83 @@ func initConfig() {
 	log.SetFormatter(formatter)
 	log.SetOutput(prefixedWriter{})
 
-	viper.SetConfigName(".zpm")
-	viper.AddConfigPath("$HOME")
-
-	viper.SetDefault(configKeyPlugins, []string{})
+	viper.SetDefault(configKeyPlugins, []interface{}{})
 	viper.SetDefault(configKeyLoggingLevel, "info")
 	viper.SetDefault(configKeyOnLoadInstallMissingPlugins, true)
 	viper.SetDefault(configKeyOnLoadCheckForUpdates, true)
 	viper.SetDefault(configKeyOnLoadUpdateCheckPeriod, "24h")
+	viper.SetDefault(configKeyCompinitEnabled, true)
+	viper.SetDefault(configKeyCompinitMode, compinitModeUnsafe)
+	viper.SetDefault(configKeyCompinitDumpFile, "")
+	viper.SetDefault(configKeyLoadTemplate, "")
+	viper.SetDefault(configKeyLocalChanges, string(plugin.LocalChangesSkip))
+	viper.SetDefault(configKeyJobs, 8)
+	viper.SetDefault(configKeyNetworkTimeout, "5m")
+	viper.SetDefault(configKeyNetworkRetries, 3)
+	viper.SetDefault(configKeyKeyring, "")
+	viper.SetDefault(configKeyRootDir, "")
+	viper.SetDefault(configKeyLockTimeout, "1m")
 
 	home, err := getHomeDir()
-	rootDir = filepath.Join(home, ".zpm_plugins")
-
-	if err := os.MkdirAll(rootDir, os.ModePerm); err != nil && !os.IsExist(err) {
-		log.Fatalf("while creating the plugin storage directory: %s", err)
+	if err != nil {
+		log.Fatalf("cannot find the home directory: %s", err)
 	}
 
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			log.Fatalf("failed to read configuration: %s", err)
+	configFilePath, err = expandPath(appConfigFile)
+	if err != nil {
+		log.Fatalf("failed to parse --config: %s", err)
+	}
+	if configFilePath == "" {
+		legacyConfigFilePath := filepath.Join(home, ".zpm.yaml")
+		configFilePath = migrate(legacyConfigFilePath, defaultConfigFilePath(home))
+		if configFilePath != legacyConfigFilePath {
+			// the lock file is stored next to the configuration file
+			migrate(filepath.Join(home, "zpm.lock"), lockFilePath())
 		}
+	}
+	viper.SetConfigFile(configFilePath)
+
+	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
 		// write defaults
-		configFilePath := filepath.Join(home, ".zpm.yaml")
 		allSettings := viper.AllSettings()
 		allSettingsBytes, err := yaml.Marshal(allSettings)
 		if err != nil {
 			log.Fatalf("failed to serialize settings: %s", err)
 		}
+		if err := os.MkdirAll(filepath.Dir(configFilePath), os.ModePerm); err != nil {
+			log.Fatalf("while creating the configuration directory: %s", err)
+		}
 		if err := ioutil.WriteFile(configFilePath, allSettingsBytes, os.ModePerm); err != nil {
 			log.Fatalf("failed to write the default config to the drive: %s", err)
 		}
+	} else if err := viper.ReadInConfig(); err != nil {
+		log.Fatalf("failed to read configuration: %s", err)
 	}
 
-	pluginsSpecs = viper.GetStringSlice(configKeyPlugins)
+	if rootDir = os.Getenv(rootDirEnv); rootDir != "" {
+		if rootDir, err = resolveRootDir(rootDir, "."); err != nil {
+			log.Fatalf("failed to parse %s: %s", rootDirEnv, err)
+		}
+	} else if rootDir = viper.GetString(configKeyRootDir); rootDir != "" {
+		if rootDir, err = resolveRootDir(rootDir, filepath.Dir(configFilePath)); err != nil {
+			log.Fatalf("failed to parse %s: %s", configKeyRootDir, err)
+		}
+	} else {
+		rootDir = migrate(filepath.Join(home, ".zpm_plugins"), defaultRootDir(home))
+	}
+	stateDir = defaultStateDir(home)
+	migrateStateFiles(rootDir, stateDir)
+
+	for _, dir := range []string{rootDir, stateDir} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil && !os.IsExist(err) {
+			log.Fatalf("while creating the zpm directories: %s", err)
+		}
+	}
+
+	pluginsConfigs, err = plugin.ParseConfigs(cast.ToSlice(viper.Get(configKeyPlugins)))
+	if err != nil {
+		log.Fatalf("failed to read plugins configuration: %s", err)
+	}
 
 	level, err := log.ParseLevel(viper.GetString(configKeyLoggingLevel))
 	if err != nil {
@@ -142,4 +219,51 @@ func initConfig() {
 	if err != nil {
 		log.Fatalf("failed to parse OnLoad.UpdateCheckPeriod")
 	}
+
+	localChangesPolicy, err = plugin.ParseLocalChangesPolicy(viper.GetString(configKeyLocalChanges))
+	if err != nil {
+		log.Fatalf("failed to parse %s: %s", configKeyLocalChanges, err)
+	}
+
+	networkOptions.Timeout, err = time.ParseDuration(viper.GetString(configKeyNetworkTimeout))
+	if err != nil {
+		log.Fatalf("failed to parse %s: %s", configKeyNetworkTimeout, err)
+	}
+	networkOptions.Retries = viper.GetInt(configKeyNetworkRetries)
+
+	lockTimeout, err = time.ParseDuration(viper.GetString(configKeyLockTimeout))
+	if err != nil {
+		log.Fatalf("failed to parse %s: %s", configKeyLockTimeout, err)
+	}
+
+	authOptions, err = plugin.ParseAuthOptions(viper.GetStringMap(configKeyAuth))
+	if err != nil {
+		log.Fatalf("failed to parse %s: %s", configKeyAuth, err)
+	}
+	for host, auth := range authOptions.Hosts {
+		if auth.KeyFile, err = expandPath(auth.KeyFile); err != nil {
+			log.Fatalf("failed to parse %s: %s", configKeyAuth, err)
+		}
+		authOptions.Hosts[host] = auth
+	}
+
+	keyringPath, err = expandPath(viper.GetString(configKeyKeyring))
+	if err != nil {
+		log.Fatalf("failed to parse %s: %s", configKeyKeyring, err)
+	}
+}
+
+// makePluginStorage reads the configured plugins and applies the settings of
+// update and install operations.
+func makePluginStorage() *plugin.PluginStorage {
+	ps, err := plugin.MakePluginStorage(rootDir, pluginsConfigs)
+	if err != nil {
+		log.Fatalf("while reading plugin configurations: %s", err)
+	}
+	ps.LocalChangesPolicy = localChangesPolicy
+	ps.Jobs = viper.GetInt(configKeyJobs)
+	ps.Network = networkOptions
+	ps.Auth = authOptions
+	ps.Keyring = keyringPath
+	return ps
 }
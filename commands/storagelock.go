@@ -0,0 +1,22 @@
+package commands
+
+import (
+	"github.com/eugene-babichenko/zpm/plugin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// lockStorage locks the plugin storage for the rest of the command. Commands
+// changing plugin repositories take the exclusive lock, other commands share
+// the lock.
+func lockStorage(ps *plugin.PluginStorage, exclusive bool) (unlock func()) {
+	lock, err := ps.LockStorage(exclusive, lockTimeout)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	return func() {
+		if err := lock.Unlock(); err != nil {
+			log.Errorf("%s", err)
+		}
+	}
+}
@@ -14,7 +14,7 @@ import (
 
 func setLastUpdateTime(t time.Time) error {
 	s := t.Format(time.RFC3339)
-	filename := filepath.Join(rootDir, ".lastupdate")
+	filename := filepath.Join(stateDir, lastUpdateFileName)
 	err := ioutil.WriteFile(filename, []byte(s), os.ModePerm)
 	return err
 }
@@ -24,18 +24,38 @@ var updateCmd = &cobra.Command{
 	Short: "Install updates",
 	Run: func(cmd *cobra.Command, args []string) {
 		pluginToUpdate, _ := cmd.Flags().GetString("plugin")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		force, _ := cmd.Flags().GetBool("force")
 
-		log.Info("updating installed plugins...")
-		log.Info("not installing new plugins! Run `zpm install` to do it.")
+		ps := makePluginStorage()
+		defer lockStorage(ps, true)()
+		if force {
+			ps.LocalChangesPolicy = plugin.LocalChangesReset
+		}
+		defer handleInterrupts(ps)()
+		defer startProgress(ps)()
 
-		ps, err := plugin.MakePluginStorage(rootDir, pluginsSpecs)
-		if err != nil {
-			log.Fatalf("while reading plugin configurations: %s", err)
+		if dryRun {
+			if pluginToUpdate == "" {
+				ps.CheckPluginUpdates(false)
+			} else {
+				pse, ok := ps.Plugins[pluginToUpdate]
+				if !ok {
+					log.Fatalf("plugin %s not listed in the configuration file", pluginToUpdate)
+				}
+				pse.CheckPluginUpdate(false)
+			}
+			printChangelogs(os.Stdout, ps, 0, true)
+			return
 		}
 
+		log.Info("updating installed plugins...")
+		log.Info("not installing new plugins! Run `zpm install` to do it.")
+
 		if pluginToUpdate == "" {
 			ps.CheckPluginUpdates(false)
 			ps.UpdateAll()
+			writeLock(ps)
 			if err := setLastUpdateTime(time.Now()); err != nil {
 				log.Errorf("failed to write last update time: %s", err)
 				log.Error("note that this will result in extra update checks on zsh load")
@@ -48,8 +68,11 @@ var updateCmd = &cobra.Command{
 		if !ok {
 			log.Fatalf("plugin %s not listed in the configuration file", pluginToUpdate)
 		}
+		// an explicit update is the only way to update a rolled back plugin
+		pse.AllowUpdate()
 		pse.CheckPluginUpdate(false)
 		pse.Update()
+		writeLock(ps)
 
 		log.Info("update finished")
 	},
@@ -61,6 +84,16 @@ func init() {
 		"",
 		"Update only the specified plugin",
 	)
+	updateCmd.Flags().Bool(
+		"dry-run",
+		false,
+		"Show the changes updates will bring without installing them",
+	)
+	updateCmd.Flags().Bool(
+		"force",
+		false,
+		"Discard local changes of plugins instead of skipping their updates",
+	)
 
 	RootCmd.AddCommand(updateCmd)
 }
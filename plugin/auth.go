@@ -0,0 +1,303 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+// Authentication methods for Git servers.
+const (
+	// Repositories are cloned over SSH with the keys of the running SSH agent.
+	AuthSSHAgent = "ssh-agent"
+	// Repositories are cloned over SSH with a private key file.
+	AuthSSHKey = "ssh-key"
+	// Repositories are cloned over HTTPS with a token read from an environment
+	// variable.
+	AuthToken = "token"
+	// Repositories are cloned over HTTPS with the credentials from the netrc
+	// file.
+	AuthNetrc = "netrc"
+	// Repositories are cloned over HTTPS with the credentials provided by the
+	// credential helpers configured for Git.
+	AuthCredentialHelper = "credential-helper"
+)
+
+// The user name used for SSH connections and token authentication unless
+// another one is configured.
+const defaultAuthUser = "git"
+
+// AuthConfig defines how to authenticate to the Git server of a host.
+type AuthConfig struct {
+	Method string `mapstructure:"method"`
+	// The SSH user or the HTTPS user name.
+	User string `mapstructure:"user"`
+	// The private key file for the `ssh-key` method.
+	KeyFile string `mapstructure:"key_file"`
+	// The environment variable containing the passphrase of the key file.
+	PassphraseEnv string `mapstructure:"passphrase_env"`
+	// The environment variable containing the token for the `token` method.
+	TokenEnv string `mapstructure:"token_env"`
+}
+
+// AuthOptions keeps the authentication settings of Git servers.
+type AuthOptions struct {
+	// Settings by host name. Repositories on other hosts are cloned over HTTPS
+	// with the credentials from the netrc file if it has any.
+	Hosts map[string]AuthConfig
+}
+
+// ParseAuthOptions parses the `auth` section of the configuration file.
+func ParseAuthOptions(raw map[string]interface{}) (options AuthOptions, err error) {
+	options.Hosts = make(map[string]AuthConfig)
+
+	hosts := make([]string, 0, len(raw))
+	for host := range raw {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		var auth AuthConfig
+		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			ErrorUnused: true,
+			Result:      &auth,
+		})
+		if err != nil {
+			return options, err
+		}
+		if err := decoder.Decode(raw[host]); err != nil {
+			return options, errors.Wrapf(err, "invalid authentication settings of %s", host)
+		}
+
+		switch auth.Method {
+		case AuthSSHAgent, AuthNetrc, AuthCredentialHelper:
+		case AuthSSHKey:
+			if auth.KeyFile == "" {
+				return options, fmt.Errorf("%s: key_file is required for %s", host, auth.Method)
+			}
+		case AuthToken:
+			if auth.TokenEnv == "" {
+				return options, fmt.Errorf("%s: token_env is required for %s", host, auth.Method)
+			}
+		default:
+			return options, fmt.Errorf("%s: unknown authentication method %q", host, auth.Method)
+		}
+		options.Hosts[host] = auth
+	}
+
+	return options, nil
+}
+
+// host returns the settings of a host. The zero value means no settings.
+func (o *AuthOptions) host(host string) AuthConfig {
+	if o == nil {
+		return AuthConfig{}
+	}
+	return o.Hosts[host]
+}
+
+// netrcPath returns the location of the netrc file.
+func netrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+func (a AuthConfig) isSSH() bool {
+	return a.Method == AuthSSHAgent || a.Method == AuthSSHKey
+}
+
+func (a AuthConfig) user() string {
+	if a.User == "" {
+		return defaultAuthUser
+	}
+	return a.User
+}
+
+// host returns the host name of the repository.
+func (p *Git) host() string {
+	return strings.SplitN(filepath.ToSlash(p.URL), "/", 2)[0]
+}
+
+// remoteURL returns the URL the repository is fetched from. Unlike `Source`,
+// it depends on the authentication method.
+func (p *Git) remoteURL() string {
+	auth := p.auth.host(p.host())
+	if !auth.isSSH() {
+		return p.Source()
+	}
+	path := strings.SplitN(filepath.ToSlash(p.URL), "/", 2)[1]
+	return fmt.Sprintf("ssh://%s@%s/%s.git", auth.user(), p.host(), path)
+}
+
+// authMethod makes the credentials for the repository. Nil means anonymous
+// access.
+func (p *Git) authMethod() (transport.AuthMethod, error) {
+	auth := p.auth.host(p.host())
+
+	switch auth.Method {
+	case AuthSSHAgent:
+		method, err := ssh.NewSSHAgentAuth(auth.user())
+		return method, errors.Wrap(err, "while connecting to the SSH agent")
+	case AuthSSHKey:
+		var passphrase string
+		if auth.PassphraseEnv != "" {
+			passphrase = os.Getenv(auth.PassphraseEnv)
+		}
+		method, err := ssh.NewPublicKeysFromFile(auth.user(), auth.KeyFile, passphrase)
+		return method, errors.Wrapf(err, "while reading the key %s", auth.KeyFile)
+	case AuthToken:
+		token := os.Getenv(auth.TokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("the token variable %s is not set", auth.TokenEnv)
+		}
+		return &http.BasicAuth{Username: auth.user(), Password: token}, nil
+	case AuthCredentialHelper:
+		return credentialHelperAuth(p.Source())
+	}
+
+	// netrc is used by default, like in Git and curl
+	login, password, err := readNetrc(netrcPath(), p.host())
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading the netrc file")
+	}
+	if login == "" && password == "" {
+		if auth.Method == AuthNetrc {
+			return nil, fmt.Errorf("no credentials for %s in the netrc file", p.host())
+		}
+		return nil, nil
+	}
+	return &http.BasicAuth{Username: login, Password: password}, nil
+}
+
+// setRemoteURL points the origin of an installed repository to the URL
+// required by the authentication method, e.g. when the method was changed
+// after the plugin was installed.
+func (p *Git) setRemoteURL(url string) error {
+	cfg, err := p.repository.Config()
+	if err != nil {
+		return errors.Wrap(err, "while reading the repository config")
+	}
+	remote, ok := cfg.Remotes["origin"]
+	if !ok {
+		remote = &config.RemoteConfig{
+			Name:  "origin",
+			Fetch: []config.RefSpec{config.RefSpec(config.DefaultFetchRefSpec)},
+		}
+		cfg.Remotes["origin"] = remote
+	}
+	if len(remote.URLs) == 1 && remote.URLs[0] == url {
+		return nil
+	}
+	remote.URLs = []string{url}
+	return errors.Wrap(p.repository.Storer.SetConfig(cfg), "while writing the repository config")
+}
+
+// readNetrc finds the credentials for the host in a netrc file. Empty values
+// are returned when the file or the host entry does not exist.
+func readNetrc(path string, host string) (login string, password string, err error) {
+	if path == "" {
+		return "", "", nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", "", nil
+	} else if err != nil {
+		return "", "", err
+	}
+
+	// the first entry of the host is used, the default entry matches any host
+	var entry, defaultEntry *[2]string
+	var current *[2]string
+	words := strings.Fields(string(data))
+	for i := 0; i < len(words); i++ {
+		switch words[i] {
+		case "machine":
+			current = nil
+			if i++; i < len(words) && words[i] == host && entry == nil {
+				entry = &[2]string{}
+				current = entry
+			}
+		case "default":
+			defaultEntry = &[2]string{}
+			current = defaultEntry
+		case "login", "password":
+			field := 0
+			if words[i] == "password" {
+				field = 1
+			}
+			if i++; i < len(words) && current != nil {
+				current[field] = words[i]
+			}
+		}
+	}
+
+	if entry == nil {
+		entry = defaultEntry
+	}
+	if entry == nil {
+		return "", "", nil
+	}
+	return entry[0], entry[1], nil
+}
+
+// credentialHelperAuth asks the credential helpers configured for Git for the
+// credentials of the URL with `git credential fill`.
+func credentialHelperAuth(url string) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("git", "credential", "fill")
+	// a helper must not wait for the input from a terminal
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf(
+		"protocol=%s\nhost=%s\npath=%s\n\n",
+		endpoint.Protocol,
+		endpoint.Host,
+		strings.TrimPrefix(endpoint.Path, "/"),
+	))
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "git credential fill: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	auth := &http.BasicAuth{}
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "username":
+			auth.Username = parts[1]
+		case "password":
+			auth.Password = parts[1]
+		}
+	}
+	if auth.Password == "" {
+		return nil, fmt.Errorf("no credentials for %s from the credential helpers", endpoint.Host)
+	}
+	return auth, nil
+}
@@ -0,0 +1,187 @@
+package plugin
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+// Feature: Authentication
+//   Scenario: Parse the settings of hosts
+//     When the authentication settings are read from the configuration file
+//     Then the methods and their required settings are validated
+func TestParseAuthOptions(t *testing.T) {
+	options, err := ParseAuthOptions(map[string]interface{}{
+		"github.com": map[string]interface{}{
+			"method":    "token",
+			"token_env": "GITHUB_TOKEN",
+		},
+		"gitlab.example.com": map[string]interface{}{
+			"method":   "ssh-key",
+			"key_file": "/home/user/.ssh/id_rsa",
+		},
+	})
+	require.Empty(t, err, "cannot parse valid settings")
+	expected := map[string]AuthConfig{
+		"github.com":         {Method: AuthToken, TokenEnv: "GITHUB_TOKEN"},
+		"gitlab.example.com": {Method: AuthSSHKey, KeyFile: "/home/user/.ssh/id_rsa"},
+	}
+	assert.Equal(t, expected, options.Hosts)
+
+	invalid := []map[string]interface{}{
+		{"github.com": map[string]interface{}{"method": "password"}},
+		{"github.com": map[string]interface{}{"method": "token"}},
+		{"github.com": map[string]interface{}{"method": "ssh-key"}},
+		{"github.com": map[string]interface{}{"method": "ssh-agent", "key": "value"}},
+	}
+	for _, raw := range invalid {
+		_, err := ParseAuthOptions(raw)
+		assert.NotEmpty(t, err, "invalid settings must be rejected: %v", raw)
+	}
+}
+
+//   Scenario: Clone over SSH
+//     Given a host configured for SSH authentication
+//     When the repository URL is made
+//     Then the SSH URL is used for fetching
+//     And the HTTPS URL still identifies the plugin
+func TestRemoteURL(t *testing.T) {
+	p := NewGit("github.com/user/repo", "master", "")
+	assert.Equal(t, "https://github.com/user/repo.git", p.remoteURL())
+
+	p.auth = &AuthOptions{Hosts: map[string]AuthConfig{"github.com": {Method: AuthSSHAgent}}}
+	assert.Equal(t, "ssh://git@github.com/user/repo.git", p.remoteURL())
+	assert.Equal(t, "https://github.com/user/repo.git", p.Source())
+}
+
+//   Scenario: Read credentials from the netrc file
+//     Given a netrc file with a host entry and a default entry
+//     When the credentials of hosts are read
+//     Then the host entry or the default entry is used
+func TestReadNetrc(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zpm-netrc")
+	require.Empty(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".netrc")
+	netrc := "machine github.com\n  login user\n  password secret\n" +
+		"machine github.com login other password other\n" +
+		"default login anonymous password none\n"
+	require.Empty(t, ioutil.WriteFile(path, []byte(netrc), 0600))
+
+	login, password, err := readNetrc(path, "github.com")
+	assert.Empty(t, err)
+	assert.Equal(t, "user", login)
+	assert.Equal(t, "secret", password)
+
+	login, password, err = readNetrc(path, "gitlab.com")
+	assert.Empty(t, err)
+	assert.Equal(t, "anonymous", login)
+	assert.Equal(t, "none", password)
+
+	login, password, err = readNetrc(filepath.Join(dir, "missing"), "github.com")
+	assert.Empty(t, err)
+	assert.Empty(t, login)
+	assert.Empty(t, password)
+}
+
+//   Scenario: Make credentials
+//     Given hosts configured with different methods
+//     When the credentials for repositories are made
+//     Then tokens, key files and netrc entries are used
+func TestAuthMethod(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zpm-auth")
+	require.Empty(t, err)
+	defer os.RemoveAll(dir)
+
+	// private key file
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.Empty(t, err)
+	keyFile := filepath.Join(dir, "id_rsa")
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	require.Empty(t, ioutil.WriteFile(keyFile, keyPem, 0600))
+
+	// netrc file
+	netrcFile := filepath.Join(dir, ".netrc")
+	require.Empty(t, ioutil.WriteFile(netrcFile, []byte("machine example.com login user password secret\n"), 0600))
+	defer os.Setenv("NETRC", os.Getenv("NETRC"))
+	os.Setenv("NETRC", netrcFile)
+
+	defer os.Unsetenv("ZPM_TEST_TOKEN")
+	os.Setenv("ZPM_TEST_TOKEN", "token")
+
+	options := &AuthOptions{Hosts: map[string]AuthConfig{
+		"github.com":    {Method: AuthToken, TokenEnv: "ZPM_TEST_TOKEN", User: "user"},
+		"gitlab.com":    {Method: AuthSSHKey, KeyFile: keyFile},
+		"bitbucket.org": {Method: AuthToken, TokenEnv: "ZPM_TEST_MISSING_TOKEN"},
+	}}
+	makeGit := func(URL string) Git {
+		p := NewGit(URL, "master", dir)
+		p.auth = options
+		return p
+	}
+
+	p := makeGit("github.com/user/repo")
+	auth, err := p.authMethod()
+	assert.Empty(t, err)
+	assert.Equal(t, &http.BasicAuth{Username: "user", Password: "token"}, auth)
+
+	p = makeGit("gitlab.com/user/repo")
+	auth, err = p.authMethod()
+	assert.Empty(t, err)
+	if assert.IsType(t, &ssh.PublicKeys{}, auth) {
+		assert.Equal(t, "git", auth.(*ssh.PublicKeys).User)
+	}
+
+	p = makeGit("bitbucket.org/user/repo")
+	_, err = p.authMethod()
+	assert.NotEmpty(t, err, "a missing token must be reported")
+
+	p = makeGit("example.com/user/repo")
+	auth, err = p.authMethod()
+	assert.Empty(t, err)
+	assert.Equal(t, &http.BasicAuth{Username: "user", Password: "secret"}, auth)
+
+	p = makeGit("example.org/user/repo")
+	auth, err = p.authMethod()
+	assert.Empty(t, err)
+	assert.Nil(t, auth, "repositories without credentials are accessed anonymously")
+}
+
+//   Scenario: Use Git credential helpers
+//     Given a credential helper configured for Git
+//     When the credentials for a repository are made
+//     Then the helper provides them
+func TestCredentialHelperAuth(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "zpm-credential-helper")
+	require.Empty(t, err)
+	defer os.RemoveAll(dir)
+
+	gitconfig := "[credential]\n\thelper = \"!f() { echo username=user; echo password=secret; }; f\"\n"
+	require.Empty(t, ioutil.WriteFile(filepath.Join(dir, ".gitconfig"), []byte(gitconfig), 0600))
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", dir)
+	defer os.Setenv("GIT_CONFIG_NOSYSTEM", os.Getenv("GIT_CONFIG_NOSYSTEM"))
+	os.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	p := NewGit("github.com/user/repo", "master", dir)
+	p.auth = &AuthOptions{Hosts: map[string]AuthConfig{"github.com": {Method: AuthCredentialHelper}}}
+	auth, err := p.authMethod()
+	assert.Empty(t, err)
+	assert.Equal(t, &http.BasicAuth{Username: "user", Password: "secret"}, auth)
+}
@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// ChangelogCommit is a commit brought by an update.
+type ChangelogCommit struct {
+	Hash    string
+	Subject string
+	Author  string
+	Date    time.Time
+}
+
+// FileStat is the number of lines changed in a single file.
+type FileStat struct {
+	Name      string
+	Additions int
+	Deletions int
+}
+
+// Changelog describes the changes between the installed and the target
+// revisions of a plugin.
+type Changelog struct {
+	From string
+	To   string
+	// Commits reachable from the target revision, but not from the installed
+	// one, ordered from the newest to the oldest.
+	Commits []ChangelogCommit
+	// FastForward is false when the installed revision is not an ancestor of
+	// the target one, e.g. when the history was rewritten or an older revision
+	// is required. In this case some of the installed commits are discarded by
+	// the update.
+	FastForward bool
+	Stats       []FileStat
+}
+
+// newCommits finds the commits reachable from the target revision, but not
+// from the installed one, ordered from the newest to the oldest, and tells
+// whether the installed revision is an ancestor of the target one.
+func newCommits(from *object.Commit, to *object.Commit) (commits []ChangelogCommit, fastForward bool, err error) {
+	fastForward = from.Hash == to.Hash
+
+	// everything reachable from the installed revision is already installed
+	installed := make(map[plumbing.Hash]bool)
+	err = object.NewCommitPreorderIter(from, nil, nil).ForEach(func(c *object.Commit) error {
+		installed[c.Hash] = true
+		return nil
+	})
+	// the history of shallow clones ends with missing parents
+	if err != nil && err != plumbing.ErrObjectNotFound {
+		return nil, false, errors.Wrap(err, "while reading the installed history")
+	}
+
+	err = object.NewCommitPreorderIter(to, installed, nil).ForEach(func(c *object.Commit) error {
+		commits = append(commits, ChangelogCommit{
+			Hash:    c.Hash.String(),
+			Subject: strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0],
+			Author:  c.Author.Name,
+			Date:    c.Author.When,
+		})
+		// the installed revision is an ancestor of the target one only when
+		// some of the new commits is its direct descendant
+		for _, parent := range c.ParentHashes {
+			if parent == from.Hash {
+				fastForward = true
+			}
+		}
+		return nil
+	})
+	if err != nil && err != plumbing.ErrObjectNotFound {
+		return nil, false, errors.Wrap(err, "while reading the update history")
+	}
+
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].Date.After(commits[j].Date)
+	})
+	return commits, fastForward, nil
+}
+
+// makeChangelog compares two commits from the same repository.
+func makeChangelog(from *object.Commit, to *object.Commit) (*Changelog, error) {
+	commits, fastForward, err := newCommits(from, to)
+	if err != nil {
+		return nil, err
+	}
+	changelog := &Changelog{
+		From:        from.Hash.String(),
+		To:          to.Hash.String(),
+		Commits:     commits,
+		FastForward: fastForward,
+	}
+
+	patch, err := from.Patch(to)
+	if err != nil {
+		return nil, errors.Wrap(err, "while comparing revisions")
+	}
+	for _, stat := range patch.Stats() {
+		changelog.Stats = append(changelog.Stats, FileStat{
+			Name:      stat.Name,
+			Additions: stat.Addition,
+			Deletions: stat.Deletion,
+		})
+	}
+
+	return changelog, nil
+}
+
+// Changelog returns the changes brought by the update found by `CheckUpdate`.
+func (p *Git) Changelog() (*Changelog, error) {
+	from, to, err := p.updateCommits()
+	if err != nil {
+		return nil, err
+	}
+	return makeChangelog(from, to)
+}
+
+// updateCommits returns the installed and the target commits of the update
+// found by `CheckUpdate`.
+func (p *Git) updateCommits() (from *object.Commit, to *object.Commit, err error) {
+	if p.repository == nil || p.update == nil {
+		return nil, nil, errors.New("no update available")
+	}
+
+	head, err := p.repository.Head()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot read repository HEAD")
+	}
+	from, err = p.repository.CommitObject(head.Hash())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot read the installed commit")
+	}
+	to, err = p.repository.CommitObject(*p.update)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot read the target commit")
+	}
+	return from, to, nil
+}
@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4"
+)
+
+// Feature: Update changelog
+//   Scenario: Fast-forward update
+//     Given that the target revision is a descendant of the installed one
+//     When the changelog is made
+//     Then it lists the new commits from the newest to the oldest
+//     And the update is a fast-forward one
+//     And the changed files are listed
+func TestChangelogFastForward(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	first := makeTestCommit(t, tempDir, "a.plugin.zsh", "first commit")
+	second := makeTestCommit(t, tempDir, "b.plugin.zsh", "second commit\n\ndetails")
+	third := makeTestCommit(t, tempDir, "a.plugin.zsh", "third commit")
+
+	repository, err := git.PlainOpen(tempDir)
+	require.Empty(t, err, "cannot open the repository")
+	from, err := repository.CommitObject(first)
+	require.Empty(t, err, "cannot read a commit")
+	to, err := repository.CommitObject(third)
+	require.Empty(t, err, "cannot read a commit")
+
+	changelog, err := makeChangelog(from, to)
+	require.Empty(t, err, "cannot make the changelog")
+
+	assert.True(t, changelog.FastForward, "must be a fast-forward update")
+	require.Len(t, changelog.Commits, 2, "invalid number of commits")
+	assert.Equal(t, third.String(), changelog.Commits[0].Hash, "invalid commit order")
+	assert.Equal(t, "third commit", changelog.Commits[0].Subject, "invalid subject")
+	assert.Equal(t, second.String(), changelog.Commits[1].Hash, "invalid commit order")
+	assert.Equal(t, "second commit", changelog.Commits[1].Subject, "invalid subject")
+	assert.Equal(t, "zpm", changelog.Commits[1].Author, "invalid author")
+
+	expectedStats := []FileStat{
+		{Name: "a.plugin.zsh", Additions: 1, Deletions: 1},
+		{Name: "b.plugin.zsh", Additions: 3, Deletions: 0},
+	}
+	assert.Equal(t, expectedStats, changelog.Stats, "invalid stats")
+}
+
+//   Scenario: Moving to an older revision
+//     Given that the target revision is an ancestor of the installed one
+//     When the changelog is made
+//     Then no commits are listed
+//     And the update is not a fast-forward one
+func TestChangelogNotFastForward(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	first := makeTestCommit(t, tempDir, "a.plugin.zsh", "first commit")
+	second := makeTestCommit(t, tempDir, "a.plugin.zsh", "second commit")
+
+	repository, err := git.PlainOpen(tempDir)
+	require.Empty(t, err, "cannot open the repository")
+	from, err := repository.CommitObject(second)
+	require.Empty(t, err, "cannot read a commit")
+	to, err := repository.CommitObject(first)
+	require.Empty(t, err, "cannot read a commit")
+
+	changelog, err := makeChangelog(from, to)
+	require.Empty(t, err, "cannot make the changelog")
+
+	assert.False(t, changelog.FastForward, "must not be a fast-forward update")
+	assert.Empty(t, changelog.Commits, "must not list any commits")
+}
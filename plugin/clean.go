@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Orphan is a repository in the plugin storage that no configured plugin
+// resolves to, e.g. because the plugin was removed from the configuration.
+type Orphan struct {
+	Path string
+	// The total size of the files in bytes.
+	Size int64
+}
+
+// pluginsDir returns the directory plugins are installed into.
+func (ps *PluginStorage) pluginsDir() string {
+	return filepath.Join(ps.root, "Plugins")
+}
+
+// Orphans finds the repositories in the plugin storage that are not required
+// by the configured plugins. Directories of local plugins (`dir://`) are never
+// reported, even if they are repositories.
+func (ps *PluginStorage) Orphans() ([]Orphan, error) {
+	required := make(map[string]bool)
+	var local []string
+	for _, pse := range ps.Plugins {
+		if dir := pse.Directory(); dir != "" {
+			required[dir] = true
+		} else if p, ok := pse.Plugin.(Dir); ok && pse.kind == "dir" {
+			local = append(local, p.Path)
+		}
+	}
+
+	root := ps.pluginsDir()
+	var orphans []Orphan
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == root {
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if !info.IsDir() || path == root {
+			return nil
+		}
+		if required[path] {
+			return filepath.SkipDir
+		}
+		for _, localPath := range local {
+			if within(path, localPath) {
+				// the directory is a local plugin or inside of one
+				return filepath.SkipDir
+			}
+		}
+		if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+			// not a repository, repositories may be deeper
+			return nil
+		}
+		for _, localPath := range local {
+			if within(localPath, path) {
+				// the repository contains a local plugin
+				return filepath.SkipDir
+			}
+		}
+
+		size, err := dirSize(path)
+		if err != nil {
+			return err
+		}
+		orphans = append(orphans, Orphan{Path: path, Size: size})
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "while searching for orphaned plugins")
+	}
+	return orphans, nil
+}
+
+// RemoveOrphan deletes an orphaned repository and the parent directories left
+// empty, like the directory of a GitHub user.
+func (ps *PluginStorage) RemoveOrphan(orphan Orphan) error {
+	if err := os.RemoveAll(orphan.Path); err != nil {
+		return errors.Wrapf(err, "while deleting %s", orphan.Path)
+	}
+	root := ps.pluginsDir()
+	for dir := filepath.Dir(orphan.Path); dir != root && within(dir, root); dir = filepath.Dir(dir) {
+		// fails for directories that are not empty
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// within tells whether the path is the directory or is inside of it.
+func within(path string, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// dirSize returns the total size of the files in the directory.
+func dirSize(dir string) (size int64, err error) {
+	err = filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
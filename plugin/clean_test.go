@@ -0,0 +1,52 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Feature: Cleaning the plugin storage
+//   Scenario: Find and delete orphaned plugins
+//     Given repositories of configured and removed plugins
+//     And a local plugin that is a repository
+//     When orphaned plugins are searched for
+//     Then only the repositories of removed plugins are found
+//     And deleting them removes the directories left empty
+func TestOrphans(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	pluginsDir := filepath.Join(tempDir, "Plugins")
+	makeTestCommit(t, filepath.Join(pluginsDir, "github.com/username/repo"), "repo.plugin.zsh", "configured")
+	removed := filepath.Join(pluginsDir, "github.com/removed/repo")
+	makeTestCommit(t, removed, "repo.plugin.zsh", "removed")
+	makeTestCommit(t, filepath.Join(pluginsDir, "local/repo"), "repo.plugin.zsh", "local")
+
+	ps, err := MakePluginStorage(tempDir, []Config{
+		{Spec: "github.com/username/repo"},
+		{Spec: "dir://local/repo"},
+	})
+	require.Empty(t, err, "cannot create the plugin storage")
+
+	orphans, err := ps.Orphans()
+	require.Empty(t, err, "cannot find orphans")
+	require.Len(t, orphans, 1)
+	assert.Equal(t, removed, orphans[0].Path)
+	assert.True(t, orphans[0].Size > 0, "the size must be computed")
+
+	require.Empty(t, ps.RemoveOrphan(orphans[0]), "cannot delete the orphan")
+	_, err = os.Stat(filepath.Join(pluginsDir, "github.com/removed"))
+	assert.True(t, os.IsNotExist(err), "empty parent directories must be deleted")
+	_, err = os.Stat(filepath.Join(pluginsDir, "github.com/username/repo"))
+	assert.Empty(t, err, "configured plugins must be kept")
+
+	orphans, err = ps.Orphans()
+	require.Empty(t, err, "cannot find orphans")
+	assert.Empty(t, orphans)
+}
@@ -0,0 +1,171 @@
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+var variableNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Config is an entry of the `plugins` list in the configuration file. An entry
+// is either a plugin spec string or a mapping with the spec and the settings
+// that are applied when the plugin is loaded.
+type Config struct {
+	// The plugin specification, e.g. `github.com/username/repo@version`.
+	Spec string
+	// Variables set before the plugin is loaded (sorted by name).
+	Env []Variable
+	// zstyle settings applied before the plugin is loaded (sorted by context
+	// and style).
+	Zstyle []Zstyle
+	// A zsh condition that must be true for the plugin to be loaded.
+	Condition string
+	// Code executed before the plugin is loaded.
+	Before string
+	// Code executed after the plugin is loaded.
+	After string
+	// The number of commits fetched for plugins installed from Git
+	// repositories. Zero means the full history.
+	Depth int
+	// Check out only the directories required by the configured Oh My Zsh
+	// plugins and themes.
+	Sparse bool
+	// Install only revisions signed by a key from the configured keyring.
+	Verify bool
+}
+
+// Variable is a shell variable set before a plugin is loaded.
+type Variable struct {
+	Name   string
+	Values []string
+	// Array is true when the value was specified as a list.
+	Array bool
+}
+
+// Zstyle is a `zstyle` call performed before a plugin is loaded.
+type Zstyle struct {
+	Context string
+	Style   string
+	Values  []string
+}
+
+type rawConfig struct {
+	Spec      string                            `mapstructure:"spec"`
+	Env       map[string]interface{}            `mapstructure:"env"`
+	Zstyle    map[string]map[string]interface{} `mapstructure:"zstyle"`
+	Condition string                            `mapstructure:"if"`
+	Before    string                            `mapstructure:"before"`
+	After     string                            `mapstructure:"after"`
+	Depth     int                               `mapstructure:"depth"`
+	Sparse    bool                              `mapstructure:"sparse"`
+	Verify    bool                              `mapstructure:"verify"`
+}
+
+// configValues converts a scalar or a list from the configuration file into a
+// list of strings.
+func configValues(value interface{}) (values []string, isList bool, err error) {
+	switch value := value.(type) {
+	case []interface{}:
+		for _, item := range value {
+			itemValues, itemIsList, err := configValues(item)
+			if err != nil {
+				return nil, false, err
+			}
+			if itemIsList {
+				return nil, false, errors.New("nested lists are not allowed")
+			}
+			values = append(values, itemValues...)
+		}
+		return values, true, nil
+	case string, bool, int, int64, float64:
+		return []string{fmt.Sprint(value)}, false, nil
+	case nil:
+		return []string{""}, false, nil
+	default:
+		return nil, false, fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+// ParseConfig parses a single entry of the `plugins` list.
+func ParseConfig(entry interface{}) (config Config, err error) {
+	if spec, ok := entry.(string); ok {
+		return Config{Spec: spec}, nil
+	}
+
+	var raw rawConfig
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		ErrorUnused: true,
+		Result:      &raw,
+	})
+	if err != nil {
+		return config, err
+	}
+	if err := decoder.Decode(entry); err != nil {
+		return config, errors.Wrap(err, "invalid plugin configuration")
+	}
+	if raw.Spec == "" {
+		return config, errors.New("missing plugin spec")
+	}
+	if raw.Depth < 0 {
+		return config, fmt.Errorf("%s: depth must not be negative", raw.Spec)
+	}
+
+	config = Config{
+		Spec:      raw.Spec,
+		Condition: raw.Condition,
+		Before:    raw.Before,
+		After:     raw.After,
+		Depth:     raw.Depth,
+		Sparse:    raw.Sparse,
+		Verify:    raw.Verify,
+	}
+
+	for name, value := range raw.Env {
+		if !variableNameRegex.MatchString(name) {
+			return config, fmt.Errorf("%s: invalid variable name %q", raw.Spec, name)
+		}
+		values, isList, err := configValues(value)
+		if err != nil {
+			return config, errors.Wrapf(err, "%s: variable %s", raw.Spec, name)
+		}
+		config.Env = append(config.Env, Variable{Name: name, Values: values, Array: isList})
+	}
+	sort.Slice(config.Env, func(i, j int) bool {
+		return config.Env[i].Name < config.Env[j].Name
+	})
+
+	for context, styles := range raw.Zstyle {
+		for style, value := range styles {
+			values, _, err := configValues(value)
+			if err != nil {
+				return config, errors.Wrapf(err, "%s: zstyle %s %s", raw.Spec, context, style)
+			}
+			config.Zstyle = append(config.Zstyle, Zstyle{Context: context, Style: style, Values: values})
+		}
+	}
+	sort.Slice(config.Zstyle, func(i, j int) bool {
+		if config.Zstyle[i].Context != config.Zstyle[j].Context {
+			return config.Zstyle[i].Context < config.Zstyle[j].Context
+		}
+		return config.Zstyle[i].Style < config.Zstyle[j].Style
+	})
+
+	return config, nil
+}
+
+// ParseConfigs parses the `plugins` list of the configuration file.
+func ParseConfigs(entries []interface{}) ([]Config, error) {
+	configs := make([]Config, 0, len(entries))
+	for _, entry := range entries {
+		config, err := ParseConfig(entry)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
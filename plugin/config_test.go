@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Feature: Plugin configuration
+//   Scenario: Plain spec
+//     When an entry is a string
+//     Then it is treated as a spec without settings
+func TestParseConfigSpec(t *testing.T) {
+	config, err := ParseConfig("github.com/username/repo")
+	require.Empty(t, err, "cannot parse a valid config")
+	assert.Equal(t, Config{Spec: "github.com/username/repo"}, config, "invalid config")
+}
+
+//   Scenario: Spec with settings
+//     When an entry is a mapping
+//     Then variables and zstyles are parsed and sorted
+func TestParseConfigSettings(t *testing.T) {
+	entry := map[interface{}]interface{}{
+		"spec": "github.com/zsh-users/zsh-autosuggestions",
+		"env": map[interface{}]interface{}{
+			"ZSH_AUTOSUGGEST_USE_ASYNC": true,
+			"ZSH_AUTOSUGGEST_STRATEGY":  []interface{}{"history", "completion"},
+		},
+		"zstyle": map[interface{}]interface{}{
+			":completion:*": map[interface{}]interface{}{
+				"menu":     "select",
+				"matchers": []interface{}{"m:{a-z}={A-Z}"},
+			},
+		},
+		"before": "echo before",
+		"after":  "echo after",
+	}
+
+	config, err := ParseConfig(entry)
+	require.Empty(t, err, "cannot parse a valid config")
+
+	expected := Config{
+		Spec: "github.com/zsh-users/zsh-autosuggestions",
+		Env: []Variable{
+			{Name: "ZSH_AUTOSUGGEST_STRATEGY", Values: []string{"history", "completion"}, Array: true},
+			{Name: "ZSH_AUTOSUGGEST_USE_ASYNC", Values: []string{"true"}},
+		},
+		Zstyle: []Zstyle{
+			{Context: ":completion:*", Style: "matchers", Values: []string{"m:{a-z}={A-Z}"}},
+			{Context: ":completion:*", Style: "menu", Values: []string{"select"}},
+		},
+		Before: "echo before",
+		After:  "echo after",
+	}
+	assert.Equal(t, expected, config, "invalid config")
+}
+
+//   Scenario: Invalid settings
+//     When an entry has no spec, an unknown key or an invalid variable name
+//     Then an error is returned
+func TestParseConfigInvalid(t *testing.T) {
+	entries := []interface{}{
+		map[interface{}]interface{}{"env": map[interface{}]interface{}{"A": "b"}},
+		map[interface{}]interface{}{"spec": "dir://plugin", "unknown": "value"},
+		map[interface{}]interface{}{"spec": "dir://plugin", "env": map[interface{}]interface{}{"A;B": "c"}},
+		map[interface{}]interface{}{"spec": "oh-my-zsh", "depth": -1},
+	}
+
+	for _, entry := range entries {
+		_, err := ParseConfig(entry)
+		assert.NotEmpty(t, err, "must return an error")
+	}
+}
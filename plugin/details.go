@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PluginDetails describes everything zpm knows about a plugin.
+type PluginDetails struct {
+	PluginInfo
+	// The named parts of the spec, like the user name and the repository.
+	SpecFields map[string]string
+	// The URL the repository is fetched from. It differs from the source for
+	// hosts with SSH authentication.
+	RemoteURL string
+	// The tag selected by a version constraint.
+	ResolvedTag string
+	// The commit the required revision resolves to in the fetched history.
+	TargetRevision string
+	// The zero time means the plugin was never fetched by this version of
+	// zpm.
+	LastFetch time.Time
+	// The directories added to `fpath` and the commands executed when the
+	// plugin is loaded.
+	Fpath []string
+	Exec  []string
+	// The reason the plugin cannot be loaded.
+	LoadError string
+	// The first paragraph of the README of the plugin.
+	Readme string
+	// The revisions replaced by updates, from the oldest to the newest.
+	History []HistoryEntry
+	Frozen  bool
+}
+
+// Details describes a plugin. The states and the target revision are known
+// after `CheckPluginUpdate` is called.
+func (pse *pluginStorageEntry) Details() PluginDetails {
+	details := PluginDetails{
+		PluginInfo: pse.info(),
+		SpecFields: make(map[string]string),
+		History:    pse.History(),
+		Frozen:     pse.history.isFrozen(pse.Name),
+	}
+	for name, value := range pse.specFields {
+		if name != "" && value != "" {
+			details.SpecFields[name] = value
+		}
+	}
+
+	if g, ok := pse.Plugin.(gitBased); ok {
+		p := g.gitPlugin()
+		details.RemoteURL = p.remoteURL()
+		details.ResolvedTag = p.resolvedTag
+		details.LastFetch = p.LastFetch()
+		switch {
+		case p.update != nil:
+			details.TargetRevision = p.update.String()
+		case pse.state == pluginInstalled:
+			details.TargetRevision = details.InstalledRevision
+		}
+	}
+
+	fpath, exec, err := pse.Plugin.Load()
+	if err != nil {
+		details.LoadError = err.Error()
+	}
+	details.Fpath = fpath
+	details.Exec = exec
+	details.Readme = readmeParagraph(details.Path)
+
+	return details
+}
+
+// readmeParagraph returns the first paragraph of the README in the directory
+// with line breaks replaced by spaces. Headings, badges and HTML are skipped.
+func readmeParagraph(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	for _, name := range []string{"README.md", "readme.md", "README.markdown", "README", "README.txt"} {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+
+		var paragraph []string
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			switch {
+			case line == "":
+				if len(paragraph) > 0 {
+					return strings.Join(paragraph, " ")
+				}
+			case strings.HasPrefix(line, "==="), strings.HasPrefix(line, "---"):
+				// the underline of a heading
+				paragraph = nil
+			case strings.HasPrefix(line, "#"),
+				strings.HasPrefix(line, "[!["),
+				strings.HasPrefix(line, "!["),
+				strings.HasPrefix(line, "<"):
+				// a heading ends the paragraph as well
+				if len(paragraph) > 0 {
+					return strings.Join(paragraph, " ")
+				}
+			default:
+				paragraph = append(paragraph, line)
+			}
+		}
+		return strings.Join(paragraph, " ")
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eugene-babichenko/zpm/zsh"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Feature: Plugin details
+//   Scenario: Describe an outdated plugin
+//     Given an installed plugin with an update
+//     When its details are requested
+//     Then the spec, the revisions and the load commands are described
+func TestDetails(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	first := makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+	second := makeTestCommit(t, repoPath, "README.md", "# repo\n\n[![Build](badge.svg)](ci)\n\nThe best\nplugin.\n\nInstall it.\n")
+
+	spec := "github.com/username/repo@" + first.String()
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: spec}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	pse := ps.Plugins[spec]
+	pse.CheckPluginUpdate(true)
+
+	details := pse.Details()
+	assert.Equal(t, map[string]string{"username": "username", "repo": "repo", "version": first.String()}, details.SpecFields)
+	assert.Equal(t, "https://github.com/username/repo.git", details.RemoteURL)
+	assert.Equal(t, second.String(), details.InstalledRevision)
+	assert.Equal(t, first.String(), details.TargetRevision)
+	assert.Equal(t, StateNeedsUpdate, details.State)
+	assert.True(t, details.LastFetch.IsZero(), "the repository was never fetched")
+	assert.Equal(t, []string{repoPath}, details.Fpath)
+	assert.Equal(t, []string{zsh.Source(filepath.Join(repoPath, "repo.plugin.zsh"))}, details.Exec)
+	assert.Equal(t, "The best plugin.", details.Readme)
+}
+
+//   Scenario: Find the first paragraph of a README
+func TestReadmeParagraph(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	cases := map[string]string{
+		"Title\n=====\n\nFirst paragraph.\n":                  "First paragraph.",
+		"<p align=\"center\"><img src=\"logo.png\"></p>\nText": "Text",
+		"# Title\nText right after the title\n## Usage\n":      "Text right after the title",
+		"# Title only\n": "",
+	}
+	for readme, expected := range cases {
+		require.Empty(t, ioutil.WriteFile(filepath.Join(tempDir, "README.md"), []byte(readme), 0644))
+		assert.Equal(t, expected, readmeParagraph(tempDir), "invalid paragraph of %q", readme)
+	}
+
+	assert.Empty(t, readmeParagraph(filepath.Join(tempDir, "missing")))
+}
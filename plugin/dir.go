@@ -1,7 +1,9 @@
 package plugin
 
 import (
-	"fmt"
+	"github.com/eugene-babichenko/zpm/zsh"
+
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -33,14 +35,14 @@ func (p Dir) Load() (fpath []string, exec []string, err error) {
 		return nil, nil, errors.New("the provided path is not a directory: " + p.Path)
 	}
 
-	fpath = []string{fmt.Sprintf(p.Path)}
+	fpath = []string{p.Path}
 
-	entrypoints, err := filepath.Glob(filepath.Join(p.Path, "*.plugin.zsh"))
+	entrypoints, err := matchFiles(p.Path, "*.plugin.zsh")
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "while loading directory plugin")
 	}
 
-	themes, err := filepath.Glob(filepath.Join(p.Path, "*.zsh-theme"))
+	themes, err := matchFiles(p.Path, "*.zsh-theme")
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "while loading directory plugin")
 	}
@@ -52,13 +54,34 @@ func (p Dir) Load() (fpath []string, exec []string, err error) {
 			continue
 		}
 		if stat.Mode()&os.ModeType == 0 {
-			exec = append(exec, fmt.Sprintf("source %s", entrypoint))
+			exec = append(exec, zsh.Source(entrypoint))
 		}
 	}
 
 	return fpath, exec, nil
 }
 
+// matchFiles lists the entries of the directory that match the pattern. Unlike
+// `filepath.Glob` it does not treat special characters in the directory path
+// as a part of the pattern.
+func matchFiles(dir string, pattern string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, entry := range entries {
+		matched, err := filepath.Match(pattern, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			matches = append(matches, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return matches, nil
+}
+
 func (p Dir) CheckUpdate(bool) (*string, error) {
 	return nil, ErrNotUpgradable
 }
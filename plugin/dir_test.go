@@ -1,6 +1,8 @@
 package plugin
 
 import (
+	"github.com/eugene-babichenko/zpm/zsh"
+
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -139,3 +141,28 @@ func TestMakePluginNoPath(t *testing.T) {
 	_, err = MakeDir("", map[string]string{})
 	assert.NotEmpty(t, err, "must return error")
 }
+
+//   Scenario: Unusual directory path
+//     Given that the plugin path contains spaces, quotes and glob characters
+//     When the `Load` function is called
+//     Then the files are found
+//     And the source lines are quoted
+func TestDirLoadUnusualPath(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	pluginDir := filepath.Join(tempDir, "it's a [plugin]*")
+	err = os.MkdirAll(pluginDir, os.ModePerm)
+	require.Empty(t, err, "cannot create plugin dir")
+
+	_, err = os.Create(filepath.Join(pluginDir, "hello.plugin.zsh"))
+	require.Empty(t, err, "cannot create plugin file")
+
+	plugin, err := MakeDir(tempDir, map[string]string{"directory": "it's a [plugin]*"})
+	require.Empty(t, err, "cannot create a plugin object")
+
+	fpath, exec, err := (*plugin).Load()
+	require.Empty(t, err, "cannot load a valid plugin")
+	assert.Equal(t, []string{pluginDir}, fpath, "invalid fpath")
+	assert.Equal(t, []string{zsh.Source(filepath.Join(pluginDir, "hello.plugin.zsh"))}, exec, "invalid exec lines")
+}
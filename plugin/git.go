@@ -1,11 +1,16 @@
 package plugin
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 )
@@ -14,8 +19,35 @@ import (
 type Git struct {
 	// Remote URL
 	URL string
-	// The required revision. This can be a branch, a tag or a commit hash.
+	// The required revision. This can be a branch, a tag, a commit hash or a
+	// semantic version constraint.
 	requiredRevision string
+	// The tag selected by a version constraint.
+	resolvedTag string
+	// The number of commits fetched from the remote. Zero means the full
+	// history.
+	depth int
+	// Timeouts and retries of network operations.
+	network *NetworkOptions
+	// Credentials of the Git servers.
+	auth *AuthOptions
+	// The file with the armored OpenPGP keyring required revisions must be
+	// signed with. Nil means signatures are not verified.
+	keyring *string
+	// Receives the phases of operations and the progress messages of the
+	// remote.
+	progress func(phase string, detail string)
+	// Directories checked out by a sparse checkout. Nil means the whole
+	// repository is checked out.
+	sparsePaths []string
+	// Set by `CheckUpdate` when the required revision is not found in the
+	// shallow history, so the full history must be cloned.
+	reclone bool
+	// Files changed in the worktree, found by `CheckUpdate`. The update
+	// discards them.
+	localChanges []LocalChange
+	// Allows the update to discard the local changes.
+	discardChanges bool
 	// We reuse the `Dir` plugin type to load the plugin into zsh.
 	Dir        Dir
 	repository *git.Repository
@@ -55,14 +87,133 @@ func (p *Git) CheckUpdate(offline bool) (message *string, err error) {
 	}
 	currentVersion := currentHead.Hash()
 
+	// local changes are reported whether there is an update or not
+	if err := p.checkLocalChanges(); err != nil {
+		return nil, err
+	}
+
 	if !offline {
-		fetchOptions := git.FetchOptions{}
+		p.reportPhase("fetching", "")
+		if err := p.setRemoteURL(p.remoteURL()); err != nil {
+			return nil, err
+		}
+		auth, err := p.authMethod()
+		if err != nil {
+			return nil, errors.Wrap(err, "while preparing the credentials")
+		}
+		fetchOptions := git.FetchOptions{
+			Depth:    p.depth,
+			Auth:     auth,
+			Progress: p.sideband("fetching"),
+		}
+		if isVersionConstraint(p.requiredRevision) {
+			// only tags pointing to fetched commits are fetched by default
+			fetchOptions.Tags = git.AllTags
+		}
 		if err := fetchOptions.Validate(); err != nil {
 			return nil, errors.Wrap(err, "while fetching the repository")
 		}
-		if err := p.repository.Fetch(&fetchOptions); err != nil && err != git.NoErrAlreadyUpToDate {
+		err = p.retry("fetching", func(ctx context.Context) error {
+			err := p.repository.FetchContext(ctx, &fetchOptions)
+			if err == git.NoErrAlreadyUpToDate {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
 			return nil, errors.Wrap(err, "while fetching the repository")
 		}
+		p.recordFetch()
+	}
+
+	p.reportPhase("resolving", p.requiredRevision)
+	newVersion, err := p.resolveRevision()
+	if err != nil && p.isShallow() && mayBeInFullHistory(p.requiredRevision, err) {
+		// the required revision may be older than the fetched history
+		updateString := fmt.Sprintf(
+			"%s: not found in the shallow history, the full history will be cloned",
+			p.requiredRevision,
+		)
+		p.reclone = true
+		return &updateString, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	pendingCommits := p.pendingUpdate()
+	pending := len(pendingCommits) > 0
+	if *newVersion == currentVersion && !pending {
+		incomplete, err := p.sparseIncomplete(currentVersion)
+		if err != nil {
+			return nil, err
+		}
+		if !incomplete {
+			return nil, UpToDate
+		}
+		updateString := fmt.Sprintf("%s: check out missing directories", p.requiredRevision)
+		p.update = newVersion
+		return &updateString, nil
+	}
+
+	if err := p.verifyRevision(*newVersion); err != nil {
+		return nil, err
+	}
+
+	target := p.requiredRevision
+	if p.resolvedTag != "" {
+		target = fmt.Sprintf("%s (%s)", p.requiredRevision, p.resolvedTag)
+	}
+	if pending {
+		updateString := fmt.Sprintf("%s: resume the interrupted update to %s", target, newVersion.String()[:7])
+		p.update = newVersion
+		// the files left by the interrupted checkout are replaced, other
+		// changes are left to the local changes policy
+		if err := p.dropCheckoutLeftovers(pendingCommits); err != nil {
+			return nil, err
+		}
+		p.discardChanges = len(p.localChanges) == 0
+		return &updateString, nil
+	}
+	updateString := fmt.Sprintf(
+		"%s: update from %s to %s",
+		target,
+		currentVersion.String()[:7],
+		newVersion.String()[:7],
+	)
+	p.update = newVersion
+	return &updateString, nil
+}
+
+// mayBeInFullHistory tells whether a revision that cannot be resolved in a
+// shallow clone may be found in the full history: a commit hash may be older
+// than the fetched commits and a version constraint may match tags of older
+// commits. Invalid constraints and unknown branch or tag names are errors,
+// because the full history does not help with them.
+func mayBeInFullHistory(revision string, err error) bool {
+	if _, ok := errors.Cause(err).(*noMatchingTagsError); ok {
+		return true
+	}
+	if isVersionConstraint(revision) || len(revision) < 4 || len(revision) > 40 {
+		return false
+	}
+	for _, c := range revision {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveRevision finds the commit hash of the required revision.
+func (p *Git) resolveRevision() (*plumbing.Hash, error) {
+	p.resolvedTag = ""
+	if isVersionConstraint(p.requiredRevision) {
+		tag, hash, err := resolveVersionConstraint(p.repository, p.requiredRevision)
+		if err != nil {
+			return nil, err
+		}
+		p.resolvedTag = tag
+		return hash, nil
 	}
 
 	// because we fetch, not pull, we need to check the remote branches
@@ -80,48 +231,289 @@ func (p *Git) CheckUpdate(offline bool) (message *string, err error) {
 			return nil, errors.New("failed to get the revision")
 		}
 	}
+	return newVersion, nil
+}
 
-	if *newVersion == currentVersion {
-		return nil, UpToDate
+// Source returns the URL the repository is cloned from.
+func (p *Git) Source() string {
+	return fmt.Sprintf("https://%s.git", p.URL)
+}
+
+// pin makes the plugin use the exact commit instead of the configured
+// revision.
+func (p *Git) pin(commit string) {
+	p.requiredRevision = commit
+}
+
+func (p *Git) InstallUpdate() error {
+	if len(p.localChanges) > 0 && !p.discardChanges {
+		return ErrLocalChanges
 	}
+	defer func() {
+		p.localChanges = nil
+		p.discardChanges = false
+	}()
 
-	updateString := fmt.Sprintf(
-		"%s: update from %s to %s",
-		p.requiredRevision,
-		currentVersion.String()[:7],
-		newVersion.String()[:7],
-	)
-	p.update = newVersion
+	// install if an existing installation not found, the full history replaces
+	// a shallow clone the same way
+	if p.repository == nil || p.reclone {
+		return p.install()
+	}
 
-	return &updateString, nil
+	if p.update == nil {
+		return errors.New("no update available")
+	}
+	return p.checkout()
 }
 
-func (p *Git) InstallUpdate() error {
-	// install if an existing installation not found
-	if p.repository == nil {
-		parentPath := filepath.Dir(p.Dir.Path)
-		if err := os.MkdirAll(parentPath, os.ModePerm); err != nil && !os.IsExist(err) {
-			return errors.Wrap(err, "while creating github plugin object")
-		}
+// stagingPrefix starts the names of the directories new clones are made in.
+// They are hidden next to the plugin directory, so they are on the same file
+// system and can be renamed.
+const stagingPrefix = ".zpm-staging-"
 
-		repositoryURL := fmt.Sprintf("https://%s.git", p.URL)
-		cloneOptions := git.CloneOptions{URL: repositoryURL}
-		if _, err := git.PlainClone(p.Dir.Path, false, &cloneOptions); err != nil {
-			return errors.Wrap(err, "while cloning the repository")
+// install clones the repository into a staging directory, checks out the
+// required revision and moves the staging directory into place. The plugin
+// stays not installed (or keeps the previous clone) when the install fails or
+// is interrupted.
+func (p *Git) install() error {
+	path := p.Dir.Path
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil && !os.IsExist(err) {
+		return errors.Wrap(err, "while creating github plugin object")
+	}
+	staging, err := ioutil.TempDir(filepath.Dir(path), stagingPrefix+filepath.Base(path)+"-")
+	if err != nil {
+		return errors.Wrap(err, "while creating the staging directory")
+	}
+	defer os.RemoveAll(staging)
+
+	// the clone and the checkout happen in the staging directory
+	p.Dir.Path = staging
+	err = p.installStaging()
+	p.Dir.Path = path
+	p.repository = nil
+	if err != nil {
+		return err
+	}
+
+	replaced := ""
+	if _, err := os.Lstat(path); err == nil {
+		// the shallow clone replaced by the full history
+		replaced = staging + ".replaced"
+		if err := os.Rename(path, replaced); err != nil {
+			return errors.Wrap(err, "while replacing the shallow clone")
+		}
+	}
+	if err := os.Rename(staging, path); err != nil {
+		// the previous clone is kept in place of the failed one
+		if replaced != "" {
+			if err := os.Rename(replaced, path); err != nil {
+				log.Errorf("while restoring %s: %s, the previous clone is left in %s", path, err, replaced)
+			}
+		}
+		return errors.Wrap(err, "while moving the clone into place")
+	}
+	if replaced != "" {
+		if err := os.RemoveAll(replaced); err != nil {
+			log.Errorf("while removing the replaced clone: %s", err)
 		}
+	}
+	p.repository, err = git.PlainOpen(path)
+	if err != nil {
+		return errors.Wrap(err, "while opening the repository")
+	}
+	return nil
+}
+
+// installStaging clones the repository and checks out the required revision.
+func (p *Git) installStaging() error {
+	if err := p.clone(); err != nil {
+		return err
+	}
+
+	// the clone is at the default branch, which may differ from the required
+	// revision
+	head, err := p.repository.Head()
+	if err != nil {
+		return errors.Wrap(err, "cannot read repository HEAD")
+	}
+	if *p.update == head.Hash() && !p.noCheckout() {
+		p.update = nil
 		return nil
 	}
+	return p.checkout()
+}
 
-	if p.update == nil {
-		return errors.New("no update available")
+// go-git does not write the index and the worktree atomically, so the target
+// of a checkout and the commit checked out before it are recorded in this file
+// in the Git directory until the checkout is finished. The files left by an
+// interrupted checkout are not local changes and are replaced when the update
+// is resumed.
+const pendingUpdateFileName = "zpm_pending_update"
+
+// checkout checks out the update found by `CheckUpdate`.
+func (p *Git) checkout() error {
+	p.reportPhase("checking out", p.update.String()[:7])
+	pending := p.update.String() + "\n"
+	if head, err := p.repository.Head(); err == nil {
+		pending += head.Hash().String() + "\n"
+	}
+	pendingPath := filepath.Join(p.Dir.Path, git.GitDirName, pendingUpdateFileName)
+	if err := ioutil.WriteFile(pendingPath, []byte(pending), 0644); err != nil {
+		return errors.Wrap(err, "checkout error")
 	}
 
+	if err := p.checkoutWorktree(); err != nil {
+		// the marker is kept only when the process is killed during the
+		// checkout, otherwise the files are checked as local changes again
+		if err := os.Remove(pendingPath); err != nil {
+			log.Errorf("while removing %s: %s", pendingPath, err)
+		}
+		return err
+	}
+
+	p.update = nil
+	if err := os.Remove(pendingPath); err != nil {
+		return errors.Wrap(err, "checkout error")
+	}
+	return nil
+}
+
+func (p *Git) checkoutWorktree() error {
+	if p.sparsePaths != nil {
+		if err := p.checkoutSparse(*p.update); err != nil {
+			return errors.Wrap(err, "checkout error")
+		}
+		return nil
+	}
 	worktree, err := p.repository.Worktree()
 	if err != nil {
 		return errors.Wrap(err, "checkout error")
 	}
+	checkoutOptions := git.CheckoutOptions{Hash: *p.update, Force: p.discardChanges}
+	return worktree.Checkout(&checkoutOptions)
+}
 
-	return worktree.Checkout(&git.CheckoutOptions{Hash: *p.update})
+// pendingUpdate returns the commits recorded by an interrupted checkout: the
+// target and the commit checked out before it, if known.
+func (p *Git) pendingUpdate() []plumbing.Hash {
+	data, err := ioutil.ReadFile(filepath.Join(p.Dir.Path, git.GitDirName, pendingUpdateFileName))
+	if err != nil {
+		return nil
+	}
+	var commits []plumbing.Hash
+	for _, line := range strings.Fields(string(data)) {
+		commits = append(commits, plumbing.NewHash(line))
+	}
+	return commits
+}
+
+// clone clones the repository and finds the required revision. When the
+// revision is not found in a shallow clone, the full history is cloned
+// instead.
+func (p *Git) clone() error {
+	depth := p.depth
+	if p.reclone {
+		depth = 0
+	}
+	p.reclone = false
+
+	auth, err := p.authMethod()
+	if err != nil {
+		return errors.Wrap(err, "while preparing the credentials")
+	}
+
+	for {
+		p.reportPhase("cloning", "")
+		cloneOptions := git.CloneOptions{
+			URL:        p.remoteURL(),
+			Auth:       auth,
+			Depth:      depth,
+			NoCheckout: p.noCheckout(),
+			Progress:   p.sideband("cloning"),
+		}
+		if isVersionConstraint(p.requiredRevision) {
+			cloneOptions.Tags = git.AllTags
+		}
+		err = p.retry("cloning", func(ctx context.Context) error {
+			repository, err := git.PlainCloneContext(ctx, p.Dir.Path, false, &cloneOptions)
+			if err != nil {
+				// a partial clone prevents the next attempt
+				if err := os.RemoveAll(p.Dir.Path); err != nil {
+					log.Errorf("while removing a failed clone: %s", err)
+				}
+				return err
+			}
+			p.repository = repository
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "while cloning the repository")
+		}
+		p.recordFetch()
+
+		p.reportPhase("resolving", p.requiredRevision)
+		p.update, err = p.resolveRevision()
+		if err == nil {
+			return p.verifyClone()
+		} else if depth == 0 {
+			return err
+		}
+
+		log.Infof("%s is not found in the shallow clone of %s, cloning the full history", p.requiredRevision, p.URL)
+		if err := os.RemoveAll(p.Dir.Path); err != nil {
+			return errors.Wrap(err, "while removing the shallow clone")
+		}
+		depth = 0
+	}
+}
+
+// noCheckout tells whether the files must not be checked out by a clone,
+// because the checkout is sparse or the revision must be verified first.
+func (p *Git) noCheckout() bool {
+	return p.sparsePaths != nil || p.keyring != nil
+}
+
+// verifyClone verifies the revision found in a new clone. The clone is removed
+// when the verification fails, so the plugin stays not installed.
+func (p *Git) verifyClone() error {
+	err := p.verifyRevision(*p.update)
+	if err == nil {
+		return nil
+	}
+	if err := os.RemoveAll(p.Dir.Path); err != nil {
+		log.Errorf("while removing an unverified clone: %s", err)
+	}
+	p.repository = nil
+	return err
+}
+
+// go-git does not write FETCH_HEAD, so the time of the last fetch is recorded
+// by zpm in this file in the Git directory.
+const lastFetchFileName = "zpm_last_fetch"
+
+// recordFetch records the time of a successful fetch or clone.
+func (p *Git) recordFetch() {
+	path := filepath.Join(p.Dir.Path, git.GitDirName, lastFetchFileName)
+	now := time.Now()
+	if err := ioutil.WriteFile(path, []byte(now.Format(time.RFC3339)+"\n"), 0644); err != nil {
+		log.Debugf("while recording the fetch time of %s: %s", p.URL, err)
+	}
+}
+
+// LastFetch returns the time of the last fetch or clone. The zero time is
+// returned if it is not known.
+func (p *Git) LastFetch() time.Time {
+	stat, err := os.Stat(filepath.Join(p.Dir.Path, git.GitDirName, lastFetchFileName))
+	if err != nil {
+		return time.Time{}
+	}
+	return stat.ModTime()
+}
+
+// isShallow tells whether the repository was cloned with a limited history.
+func (p *Git) isShallow() bool {
+	shallow, err := p.repository.Storer.Shallow()
+	return err == nil && len(shallow) > 0
 }
 
 func (p *Git) IsInstalled() (installed bool, err error) {
@@ -133,3 +525,27 @@ func (p *Git) IsInstalled() (installed bool, err error) {
 	}
 	return true, nil
 }
+
+// Revision returns the hash of the commit currently checked out.
+func (p *Git) Revision() (string, error) {
+	repository := p.repository
+	if repository == nil {
+		var err error
+		repository, err = git.PlainOpen(p.Dir.Path)
+		if err == git.ErrRepositoryNotExists {
+			return "", NotInstalled
+		} else if err != nil {
+			return "", errors.Wrap(err, "while opening the repository")
+		}
+	}
+
+	head, err := repository.Head()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot read repository HEAD")
+	}
+	return head.Hash().String(), nil
+}
+
+func (p *Git) gitPlugin() *Git {
+	return p
+}
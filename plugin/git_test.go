@@ -2,11 +2,16 @@ package plugin
 
 import (
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 )
 
 // Check the path creation
@@ -18,3 +23,44 @@ func TestGitRepoPath(t *testing.T) {
 	expectedPath := filepath.Join(tempDir, "github.com/username/repo")
 	assert.Equal(t, expectedPath, plugin.Dir.Path, "wrong path")
 }
+
+// makeTestCommit creates a commit with a single file in the repository located
+// at path. The repository is initialized if it does not exist.
+func makeTestCommit(t *testing.T, path string, filename string, message string) plumbing.Hash {
+	repository, err := git.PlainOpen(path)
+	if err == git.ErrRepositoryNotExists {
+		repository, err = git.PlainInit(path, false)
+	}
+	require.Empty(t, err, "cannot open the test repository")
+
+	err = ioutil.WriteFile(filepath.Join(path, filename), []byte(message), os.ModePerm)
+	require.Empty(t, err, "cannot write a test file")
+
+	worktree, err := repository.Worktree()
+	require.Empty(t, err, "cannot open the worktree")
+	_, err = worktree.Add(filename)
+	require.Empty(t, err, "cannot add a test file")
+
+	hash, err := worktree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "zpm", Email: "zpm@example.com", When: time.Now()},
+	})
+	require.Empty(t, err, "cannot commit")
+
+	return hash
+}
+
+func TestGitRevision(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	plugin := NewGit("github.com/username/repo", "master", tempDir)
+
+	_, err = plugin.Revision()
+	assert.Equal(t, NotInstalled, err, "the plugin must not be installed")
+
+	hash := makeTestCommit(t, plugin.Dir.Path, "repo.plugin.zsh", "initial commit")
+
+	revision, err := plugin.Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.Equal(t, hash.String(), revision, "wrong revision")
+}
@@ -0,0 +1,138 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const historyFileName = "history.json"
+
+// HistoryEntry is a revision that was installed before an update.
+type HistoryEntry struct {
+	Revision string    `json:"revision"`
+	Time     time.Time `json:"time"`
+}
+
+// history keeps the revisions replaced by updates, so they can be rolled back.
+type history struct {
+	path  string
+	mutex sync.Mutex
+	// Replaced revisions indexed by plugin specs, from the oldest to the
+	// newest.
+	Plugins map[string][]HistoryEntry `json:"plugins"`
+	// Frozen plugins were rolled back and are not updated until they are
+	// updated explicitly.
+	Frozen map[string]bool `json:"frozen"`
+}
+
+func readHistory(path string) (*history, error) {
+	h := &history{
+		path:    path,
+		Plugins: make(map[string][]HistoryEntry),
+		Frozen:  make(map[string]bool),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return h, errors.Wrap(err, "while reading the update history")
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return h, errors.Wrap(err, "while parsing the update history")
+	}
+	if h.Plugins == nil {
+		h.Plugins = make(map[string][]HistoryEntry)
+	}
+	if h.Frozen == nil {
+		h.Frozen = make(map[string]bool)
+	}
+
+	return h, nil
+}
+
+// reload reads the history again, because other zpm processes may change it
+// while the storage is not locked.
+func (h *history) reload() error {
+	fresh, err := readHistory(h.path)
+	if err != nil {
+		return err
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.Plugins = fresh.Plugins
+	h.Frozen = fresh.Frozen
+	return nil
+}
+
+// save must be called with the mutex locked.
+func (h *history) save() error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "while serializing the update history")
+	}
+	if err := ioutil.WriteFile(h.path, data, 0644); err != nil {
+		return errors.Wrap(err, "while writing the update history")
+	}
+	return nil
+}
+
+// record saves the revision replaced by an update.
+func (h *history) record(name string, revision string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.Plugins[name] = append(h.Plugins[name], HistoryEntry{Revision: revision, Time: time.Now()})
+	return h.save()
+}
+
+// entries returns the replaced revisions of a plugin from the oldest to the
+// newest.
+func (h *history) entries(name string) []HistoryEntry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return append([]HistoryEntry(nil), h.Plugins[name]...)
+}
+
+// rollback forgets the last `steps` replaced revisions and freezes the plugin.
+func (h *history) rollback(name string, steps int) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	entries := h.Plugins[name]
+	if steps > len(entries) {
+		steps = len(entries)
+	}
+	h.Plugins[name] = entries[:len(entries)-steps]
+	h.Frozen[name] = true
+	return h.save()
+}
+
+func (h *history) isFrozen(name string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.Frozen[name]
+}
+
+func (h *history) setFrozen(name string, frozen bool) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.Frozen[name] == frozen {
+		return nil
+	}
+	if frozen {
+		h.Frozen[name] = true
+	} else {
+		delete(h.Frozen, name)
+	}
+	return h.save()
+}
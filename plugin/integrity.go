@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// CheckIntegrity checks that the repository of an installed plugin can be
+// opened, its HEAD can be resolved and all objects of the checked out tree are
+// present. Returns `NotInstalled` for plugins that are not installed and nil
+// for plugins that are not installed from Git repositories.
+func (pse *pluginStorageEntry) CheckIntegrity() error {
+	g, ok := pse.Plugin.(gitBased)
+	if !ok {
+		return nil
+	}
+	p := g.gitPlugin()
+
+	if _, err := os.Stat(p.Dir.Path); os.IsNotExist(err) {
+		return NotInstalled
+	}
+	repository, err := git.PlainOpen(p.Dir.Path)
+	if err != nil {
+		return errors.Wrap(err, "while opening the repository")
+	}
+	head, err := repository.Head()
+	if err != nil {
+		return errors.Wrap(err, "cannot read repository HEAD")
+	}
+	commit, err := repository.CommitObject(head.Hash())
+	if err != nil {
+		return errors.Wrapf(err, "cannot read the commit %s", head.Hash())
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return errors.Wrapf(err, "cannot read the tree of %s", head.Hash())
+	}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		reader, err := f.Reader()
+		if err != nil {
+			return errors.Wrapf(err, "cannot read %s", f.Name)
+		}
+		defer reader.Close()
+		// packed objects are checked when they are decompressed
+		if _, err := io.Copy(ioutil.Discard, reader); err != nil {
+			return errors.Wrapf(err, "cannot read %s", f.Name)
+		}
+		return nil
+	})
+	return err
+}
+
+// Reinstall deletes the repository of a plugin and clones it again at the
+// required revision. Local changes are lost.
+func (pse *pluginStorageEntry) Reinstall() error {
+	g, ok := pse.Plugin.(gitBased)
+	if !ok {
+		return ErrNotUpgradable
+	}
+	p := g.gitPlugin()
+
+	if err := os.RemoveAll(p.Dir.Path); err != nil {
+		return errors.Wrapf(err, "while deleting %s", pse.Name)
+	}
+	p.repository = nil
+	p.update = nil
+	p.localChanges = nil
+	p.reclone = false
+
+	pse.state = pluginNeedInstall
+	pse.install()
+	if pse.state != pluginInstalled {
+		return pse.errorState
+	}
+	return nil
+}
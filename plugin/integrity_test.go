@@ -0,0 +1,41 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// Feature: Diagnosing the plugin storage
+//   Scenario: Find corrupted repositories
+//     Given an installed plugin
+//     When an object of its checked out tree is deleted
+//     Then the repository is reported as corrupted
+func TestCheckIntegrity(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "Plugins/github.com/username/repo")
+	makeTestCommit(t, path, "repo.plugin.zsh", "content")
+
+	ps, err := MakePluginStorage(tempDir, []Config{
+		{Spec: "github.com/username/repo"},
+		{Spec: "github.com/username/missing"},
+	})
+	require.Empty(t, err, "cannot create the plugin storage")
+
+	pse := ps.Plugins["github.com/username/repo"]
+	assert.Empty(t, pse.CheckIntegrity(), "the repository must be intact")
+	assert.Equal(t, NotInstalled, ps.Plugins["github.com/username/missing"].CheckIntegrity())
+
+	blob := plumbing.ComputeHash(plumbing.BlobObject, []byte("content")).String()
+	err = os.Remove(filepath.Join(path, ".git/objects", blob[:2], blob[2:]))
+	require.Empty(t, err, "cannot delete the object")
+	assert.NotEmpty(t, pse.CheckIntegrity(), "the missing object must be found")
+}
@@ -0,0 +1,104 @@
+package plugin
+
+import (
+	"os"
+	"time"
+)
+
+// States of plugins shown to users.
+const (
+	StateInstalled    = "installed"
+	StateNeedsInstall = "needs-install"
+	StateNeedsUpdate  = "needs-update"
+	StateError        = "error"
+)
+
+// PluginInfo describes a plugin listed in the configuration file.
+type PluginInfo struct {
+	Name string `json:"name"`
+	// One of "github", "dir", "oh-my-zsh", "oh-my-zsh-plugin" or
+	// "oh-my-zsh-theme".
+	Type string `json:"type"`
+	// The URL of the repository for plugins installed from Git repositories.
+	Source string `json:"source,omitempty"`
+	// The configured branch, tag, commit or version constraint.
+	RequiredRevision string `json:"required_revision,omitempty"`
+	// The commit checked out for installed plugins.
+	InstalledRevision string `json:"installed_revision,omitempty"`
+	State             string `json:"state"`
+	// The reason of the error state.
+	Error string `json:"error,omitempty"`
+	Path  string `json:"path"`
+	// The time of the last install, update or rollback by zpm.
+	InstalledAt *time.Time `json:"installed_at,omitempty"`
+	// The time of the last successful check for updates with fetching.
+	LastCheck *time.Time `json:"last_check,omitempty"`
+	// The error of the last check with fetching, kept until a check succeeds.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// List describes all plugins in the load order. The states are known after
+// `CheckPluginUpdates` is called.
+func (ps *PluginStorage) List() []PluginInfo {
+	list := make([]PluginInfo, 0, len(ps.LoadOrder))
+	for _, name := range ps.LoadOrder {
+		list = append(list, ps.Plugins[name].info())
+	}
+	return list
+}
+
+func (pse *pluginStorageEntry) info() PluginInfo {
+	info := PluginInfo{Name: pse.Name, Type: pse.kind}
+
+	switch pse.state {
+	case pluginNeedInstall:
+		info.State = StateNeedsInstall
+	case pluginNeedUpdate:
+		info.State = StateNeedsUpdate
+	case pluginCheckError:
+		info.State = StateError
+		if pse.errorState != nil {
+			info.Error = pse.errorState.Error()
+		}
+	default:
+		info.State = StateInstalled
+	}
+
+	switch p := pse.Plugin.(type) {
+	case gitBased:
+		g := p.gitPlugin()
+		info.Source = g.Source()
+		info.RequiredRevision = g.requiredRevision
+		info.Path = g.Dir.Path
+		if revision, err := g.Revision(); err == nil {
+			info.InstalledRevision = revision
+		}
+		if record, ok := pse.Record(); ok {
+			if !record.InstalledAt.IsZero() {
+				info.InstalledAt = &record.InstalledAt
+			}
+			if !record.LastCheck.IsZero() {
+				info.LastCheck = &record.LastCheck
+			}
+			if record.Error != info.Error {
+				info.LastError = record.Error
+			}
+		}
+	case Dir:
+		info.Path = p.Path
+		_, err := os.Stat(p.Path)
+		if err == nil {
+			break
+		}
+		if pse.kind == "dir" {
+			// local plugins are never installed by zpm
+			info.State = StateError
+			info.Error = err.Error()
+		} else {
+			// plugins and themes of Oh My Zsh are installed with it
+			info.State = StateNeedsInstall
+		}
+	}
+
+	return info
+}
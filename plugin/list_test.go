@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Feature: Listing plugins
+//   Scenario: Describe plugins offline
+//     Given installed, missing and outdated plugins
+//     When the plugins are checked offline
+//     Then their types, revisions, states and paths are listed in the load order
+func TestList(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	pluginsDir := filepath.Join(tempDir, "Plugins")
+	repoPath := filepath.Join(pluginsDir, "github.com/username/repo")
+	first := makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+	second := makeTestCommit(t, repoPath, "repo.plugin.zsh", "second commit")
+	require.Empty(t, os.MkdirAll(filepath.Join(pluginsDir, "local"), os.ModePerm))
+
+	configs := []Config{
+		{Spec: "github.com/username/repo@" + first.String()},
+		{Spec: "github.com/username/missing"},
+		{Spec: "dir://local"},
+		{Spec: "dir://deleted"},
+	}
+	ps, err := MakePluginStorage(tempDir, configs)
+	require.Empty(t, err, "cannot create the plugin storage")
+	ps.CheckPluginUpdates(true)
+
+	list := ps.List()
+	require.Len(t, list, 4)
+
+	assert.Equal(t, PluginInfo{
+		Name:              configs[0].Spec,
+		Type:              "github",
+		Source:            "https://github.com/username/repo.git",
+		RequiredRevision:  first.String(),
+		InstalledRevision: second.String(),
+		State:             StateNeedsUpdate,
+		Path:              repoPath,
+	}, list[0])
+	assert.Equal(t, PluginInfo{
+		Name:             configs[1].Spec,
+		Type:             "github",
+		Source:           "https://github.com/username/missing.git",
+		RequiredRevision: "master",
+		State:            StateNeedsInstall,
+		Path:             filepath.Join(pluginsDir, "github.com/username/missing"),
+	}, list[1])
+	assert.Equal(t, PluginInfo{
+		Name:  configs[2].Spec,
+		Type:  "dir",
+		State: StateInstalled,
+		Path:  filepath.Join(pluginsDir, "local"),
+	}, list[2])
+	assert.Equal(t, "dir://deleted", list[3].Name)
+	assert.Equal(t, StateError, list[3].State, "missing local plugins must be reported")
+	assert.NotEmpty(t, list[3].Error)
+}
@@ -0,0 +1,371 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	fdiff "gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/utils/diff"
+)
+
+// Returned by `Plugin.InstallUpdate` when the update would discard the local
+// changes of a plugin.
+var ErrLocalChanges = errors.New("the plugin has local changes")
+
+// LocalChangesPolicy defines what happens to the local changes of a plugin
+// when it is updated.
+type LocalChangesPolicy string
+
+const (
+	// Plugins with local changes are not updated.
+	LocalChangesSkip LocalChangesPolicy = "skip"
+	// Local changes are saved into a patch file and discarded.
+	LocalChangesBackup LocalChangesPolicy = "backup"
+	// Local changes are discarded.
+	LocalChangesReset LocalChangesPolicy = "reset"
+)
+
+// ParseLocalChangesPolicy checks the name of a policy from the configuration
+// file.
+func ParseLocalChangesPolicy(policy string) (LocalChangesPolicy, error) {
+	switch p := LocalChangesPolicy(policy); p {
+	case LocalChangesSkip, LocalChangesBackup, LocalChangesReset:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown local changes policy %q", policy)
+}
+
+// LocalChange is a file changed in the worktree of a plugin.
+type LocalChange struct {
+	Path string
+	// One of "modified", "added", "deleted" or "untracked".
+	Status string
+}
+
+// checkLocalChanges finds the files changed in the worktree. Any change blocks
+// updates: go-git checkouts refuse to overwrite modified files and remove
+// untracked ones.
+func (p *Git) checkLocalChanges() error {
+	p.localChanges = nil
+
+	worktree, err := p.repository.Worktree()
+	if err != nil {
+		return errors.Wrap(err, "while opening the worktree")
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return errors.Wrap(err, "while reading the worktree status")
+	}
+
+	for path, fileStatus := range status {
+		staging := fileStatus.Staging
+		// files skipped by a sparse checkout are staged as deleted
+		if p.sparsePaths != nil {
+			staging = git.Unmodified
+		}
+
+		change := LocalChange{Path: path}
+		switch {
+		case fileStatus.Worktree == git.Untracked:
+			change.Status = "untracked"
+		case fileStatus.Worktree == git.Deleted || staging == git.Deleted:
+			change.Status = "deleted"
+		case staging == git.Added:
+			change.Status = "added"
+		case fileStatus.Worktree != git.Unmodified || staging != git.Unmodified:
+			change.Status = "modified"
+		default:
+			continue
+		}
+		p.localChanges = append(p.localChanges, change)
+	}
+
+	sort.Slice(p.localChanges, func(i, j int) bool {
+		return p.localChanges[i].Path < p.localChanges[j].Path
+	})
+	return nil
+}
+
+// backupLocalChanges writes the local changes found by `checkLocalChanges`
+// into a patch file in the directory. The patch can be restored with
+// `git apply`.
+func (p *Git) backupLocalChanges(dir string, name string) (string, error) {
+	head, err := p.repository.Head()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot read repository HEAD")
+	}
+	commit, err := p.repository.CommitObject(head.Hash())
+	if err != nil {
+		return "", errors.Wrap(err, "cannot read the installed commit")
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot read the installed tree")
+	}
+
+	patch := localPatch{message: fmt.Sprintf("local changes of %s at %s", name, head.Hash())}
+	for _, change := range p.localChanges {
+		filePatch, err := p.localFilePatch(tree, change.Path)
+		if err != nil {
+			return "", errors.Wrapf(err, "while comparing %s", change.Path)
+		}
+		patch.filePatches = append(patch.filePatches, filePatch)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", errors.Wrap(err, "while creating the backup directory")
+	}
+	filename := fmt.Sprintf(
+		"%s-%s.patch",
+		strings.Replace(name, "/", "_", -1),
+		time.Now().Format("20060102-150405"),
+	)
+	path := filepath.Join(dir, filename)
+
+	buf := &bytes.Buffer{}
+	if err := fdiff.NewUnifiedEncoder(buf, fdiff.DefaultContextLines).Encode(patch); err != nil {
+		return "", errors.Wrap(err, "while writing the patch")
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return "", errors.Wrap(err, "while writing the patch")
+	}
+	return path, nil
+}
+
+// localFilePatch compares the installed version of a file with its version in
+// the worktree.
+func (p *Git) localFilePatch(tree *object.Tree, path string) (*localFilePatch, error) {
+	filePatch := &localFilePatch{}
+
+	var fromContents, toContents string
+	if f, err := tree.File(path); err == nil {
+		if fromContents, err = f.Contents(); err != nil {
+			return nil, err
+		}
+		filePatch.from = &localFile{hash: f.Hash, mode: f.Mode, path: path}
+	}
+
+	data, stat, err := p.readWorktreeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if stat != nil {
+		mode, err := filemode.NewFromOSFileMode(stat.Mode())
+		if err != nil {
+			return nil, err
+		}
+		toContents = string(data)
+		filePatch.to = &localFile{
+			hash: plumbing.ComputeHash(plumbing.BlobObject, data),
+			mode: mode,
+			path: path,
+		}
+	}
+
+	filePatch.binary = strings.Contains(fromContents, "\x00") || strings.Contains(toContents, "\x00")
+	if filePatch.binary {
+		return filePatch, nil
+	}
+	for _, d := range diff.Do(fromContents, toContents) {
+		chunk := localChunk{content: d.Text}
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			chunk.operation = fdiff.Equal
+		case diffmatchpatch.DiffInsert:
+			chunk.operation = fdiff.Add
+		case diffmatchpatch.DiffDelete:
+			chunk.operation = fdiff.Delete
+		}
+		filePatch.chunks = append(filePatch.chunks, chunk)
+	}
+	return filePatch, nil
+}
+
+// readWorktreeFile reads a file of the worktree or the target of a symlink.
+// The returned info is nil when the file does not exist.
+func (p *Git) readWorktreeFile(path string) ([]byte, os.FileInfo, error) {
+	fullPath := filepath.Join(p.Dir.Path, filepath.FromSlash(path))
+	stat, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if stat.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fullPath)
+		return []byte(target), stat, err
+	}
+	data, err := ioutil.ReadFile(fullPath)
+	return data, stat, err
+}
+
+// dropCheckoutLeftovers removes the files left by an interrupted checkout from
+// the local changes found by `checkLocalChanges`. A file is a leftover when it
+// matches its version in one of the commits of the checkout, so the changes
+// made by users are kept.
+func (p *Git) dropCheckoutLeftovers(commits []plumbing.Hash) error {
+	var trees []*object.Tree
+	for _, hash := range commits {
+		commit, err := p.repository.CommitObject(hash)
+		if err != nil {
+			return errors.Wrap(err, "cannot read the commit of the interrupted update")
+		}
+		tree, err := commit.Tree()
+		if err != nil {
+			return errors.Wrap(err, "cannot read the commit of the interrupted update")
+		}
+		trees = append(trees, tree)
+	}
+
+	var changes []LocalChange
+	for _, change := range p.localChanges {
+		data, stat, err := p.readWorktreeFile(change.Path)
+		if err != nil {
+			return errors.Wrapf(err, "while reading %s", change.Path)
+		}
+		leftover := false
+		for _, tree := range trees {
+			f, err := tree.File(change.Path)
+			if err == object.ErrFileNotFound {
+				leftover = stat == nil
+			} else if err != nil {
+				return errors.Wrapf(err, "while reading %s", change.Path)
+			} else {
+				leftover = stat != nil && plumbing.ComputeHash(plumbing.BlobObject, data) == f.Hash
+			}
+			if leftover {
+				break
+			}
+		}
+		if !leftover {
+			changes = append(changes, change)
+		}
+	}
+	p.localChanges = changes
+	return nil
+}
+
+// localPatch implements `diff.Patch` for the changes in the worktree, which
+// cannot be compared with `object.Tree.Patch`.
+type localPatch struct {
+	message     string
+	filePatches []fdiff.FilePatch
+}
+
+func (p localPatch) FilePatches() []fdiff.FilePatch {
+	return p.filePatches
+}
+
+func (p localPatch) Message() string {
+	return p.message
+}
+
+type localFilePatch struct {
+	from   *localFile
+	to     *localFile
+	binary bool
+	chunks []fdiff.Chunk
+}
+
+func (p *localFilePatch) IsBinary() bool {
+	return p.binary
+}
+
+func (p *localFilePatch) Files() (from fdiff.File, to fdiff.File) {
+	// nil pointers must become nil interfaces
+	if p.from != nil {
+		from = p.from
+	}
+	if p.to != nil {
+		to = p.to
+	}
+	return from, to
+}
+
+func (p *localFilePatch) Chunks() []fdiff.Chunk {
+	return p.chunks
+}
+
+type localFile struct {
+	hash plumbing.Hash
+	mode filemode.FileMode
+	path string
+}
+
+func (f *localFile) Hash() plumbing.Hash {
+	return f.hash
+}
+
+func (f *localFile) Mode() filemode.FileMode {
+	return f.mode
+}
+
+func (f *localFile) Path() string {
+	return f.path
+}
+
+type localChunk struct {
+	content   string
+	operation fdiff.Operation
+}
+
+func (c localChunk) Content() string {
+	return c.content
+}
+
+func (c localChunk) Type() fdiff.Operation {
+	return c.operation
+}
+
+// LocalChanges returns the files changed in the worktree of a plugin. Must be
+// called after `CheckPluginUpdate` checked an installed plugin.
+func (pse *pluginStorageEntry) LocalChanges() []LocalChange {
+	g, ok := pse.Plugin.(gitBased)
+	if !ok {
+		return nil
+	}
+	return g.gitPlugin().localChanges
+}
+
+// applyLocalChangesPolicy decides what happens to the local changes of a plugin
+// before an update is installed. It returns false when the update must be
+// skipped.
+func (pse *pluginStorageEntry) applyLocalChangesPolicy() bool {
+	g, ok := pse.Plugin.(gitBased)
+	if !ok || len(g.gitPlugin().localChanges) == 0 {
+		return true
+	}
+	p := g.gitPlugin()
+
+	switch pse.storage.LocalChangesPolicy {
+	case LocalChangesBackup:
+		path, err := p.backupLocalChanges(filepath.Join(pse.storage.root, "Backups"), pse.Name)
+		if err != nil {
+			log.Errorf("while saving local changes of %s: %s", pse.Name, err)
+			return false
+		}
+		log.Warnf("local changes of %s are saved to %s", pse.Name, path)
+	case LocalChangesReset:
+		log.Warnf("discarding local changes of %s", pse.Name)
+	default:
+		log.Warnf("%s has local changes, skipping the update", pse.Name)
+		log.Warnf("run `zpm update --force` to discard them or set `local_changes: backup` to save them")
+		return false
+	}
+
+	p.discardChanges = true
+	return true
+}
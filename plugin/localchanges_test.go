@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeModifiedPlugin creates a plugin that has an update and a locally modified
+// file.
+func makeModifiedPlugin(t *testing.T) (tempDir string, ps *PluginStorage, pse *pluginStorageEntry, target string) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	first := makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+	makeTestCommit(t, repoPath, "repo.plugin.zsh", "second commit")
+
+	err = ioutil.WriteFile(filepath.Join(repoPath, "repo.plugin.zsh"), []byte("local hack\n"), os.ModePerm)
+	require.Empty(t, err, "cannot modify the plugin")
+	err = ioutil.WriteFile(filepath.Join(repoPath, "cache.zwc"), []byte("cache"), os.ModePerm)
+	require.Empty(t, err, "cannot add an untracked file")
+
+	spec := "github.com/username/repo@" + first.String()
+	ps, err = MakePluginStorage(tempDir, []Config{{Spec: spec}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	return tempDir, ps, ps.Plugins[spec], first.String()
+}
+
+// Feature: Local changes
+//   Scenario: Report local changes
+//     Given a plugin with a modified and an untracked file
+//     When an update is found
+//     Then both files are reported
+func TestLocalChangesReport(t *testing.T) {
+	_, _, pse, _ := makeModifiedPlugin(t)
+
+	pse.CheckPluginUpdate(true)
+	require.True(t, pse.HasUpdate(), "the update must be found")
+	expected := []LocalChange{
+		{Path: "cache.zwc", Status: "untracked"},
+		{Path: "repo.plugin.zsh", Status: "modified"},
+	}
+	assert.Equal(t, expected, pse.LocalChanges(), "invalid local changes")
+}
+
+//   Scenario: Report local changes of up to date plugins
+//     Given an up to date plugin with a modified file
+//     When it is checked
+//     Then the file is reported
+func TestLocalChangesUpToDate(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+	err = ioutil.WriteFile(filepath.Join(repoPath, "repo.plugin.zsh"), []byte("local hack\n"), os.ModePerm)
+	require.Empty(t, err, "cannot modify the plugin")
+
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: "github.com/username/repo"}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	pse := ps.Plugins["github.com/username/repo"]
+	pse.CheckPluginUpdate(true)
+	require.False(t, pse.HasUpdate(), "the plugin must be up to date")
+	expected := []LocalChange{{Path: "repo.plugin.zsh", Status: "modified"}}
+	assert.Equal(t, expected, pse.LocalChanges(), "invalid local changes")
+}
+
+//   Scenario: Skip updates of modified plugins
+func TestLocalChangesSkip(t *testing.T) {
+	_, _, pse, target := makeModifiedPlugin(t)
+	before, _ := pse.Revision()
+
+	pse.CheckPluginUpdate(true)
+	pse.Update()
+
+	revision, err := pse.Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.Equal(t, before, revision, "the plugin must not be updated")
+	assert.NotEqual(t, target, revision)
+	assert.True(t, pse.HasUpdate(), "the update must stay available")
+}
+
+//   Scenario: Back up local changes into a patch
+//     Given the backup policy
+//     When a modified plugin is updated
+//     Then the local changes are saved into a patch file
+//     And the update is installed
+func TestLocalChangesBackup(t *testing.T) {
+	tempDir, ps, pse, target := makeModifiedPlugin(t)
+	ps.LocalChangesPolicy = LocalChangesBackup
+
+	pse.CheckPluginUpdate(true)
+	pse.Update()
+
+	revision, err := pse.Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.Equal(t, target, revision, "the plugin must be updated")
+
+	patches, err := filepath.Glob(filepath.Join(tempDir, "Backups", "github.com_username_repo@*.patch"))
+	require.Empty(t, err, "cannot list backups")
+	require.Len(t, patches, 1, "the patch must be written")
+	patch, err := ioutil.ReadFile(patches[0])
+	require.Empty(t, err, "cannot read the patch")
+	assert.Contains(t, string(patch), "+local hack", "the modification must be saved")
+	assert.Contains(t, string(patch), "-second commit", "the modification must be saved")
+	assert.Contains(t, string(patch), "+cache", "untracked files must be saved")
+
+	contents, err := ioutil.ReadFile(filepath.Join(pse.Plugin.(*Git).Dir.Path, "repo.plugin.zsh"))
+	require.Empty(t, err, "cannot read the plugin")
+	assert.Equal(t, "first commit", string(contents), "local changes must be discarded")
+}
+
+//   Scenario: Discard local changes
+func TestLocalChangesReset(t *testing.T) {
+	_, ps, pse, target := makeModifiedPlugin(t)
+	ps.LocalChangesPolicy = LocalChangesReset
+
+	pse.CheckPluginUpdate(true)
+	pse.Update()
+
+	revision, err := pse.Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.Equal(t, target, revision, "the plugin must be updated")
+}
+
+//   Scenario: Untracked files block updates
+func TestLocalChangesUntracked(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	first := makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+	makeTestCommit(t, repoPath, "repo.plugin.zsh", "second commit")
+	err = ioutil.WriteFile(filepath.Join(repoPath, "cache.zwc"), []byte("cache"), os.ModePerm)
+	require.Empty(t, err, "cannot add an untracked file")
+
+	spec := "github.com/username/repo@" + first.String()
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: spec}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	pse := ps.Plugins[spec]
+
+	pse.CheckPluginUpdate(true)
+	pse.Update()
+
+	revision, err := pse.Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.NotEqual(t, first.String(), revision, "the plugin must not be updated")
+	assert.FileExists(t, filepath.Join(repoPath, "cache.zwc"), "untracked files must be kept")
+}
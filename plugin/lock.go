@@ -0,0 +1,125 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// LockEntry records the exact revision of an installed plugin.
+type LockEntry struct {
+	Source string `yaml:"source"`
+	Commit string `yaml:"commit"`
+}
+
+// Lock records the exact revisions of all installed plugins, so the same set
+// of plugins can be installed on another machine.
+type Lock struct {
+	// Entries are indexed by plugin specs.
+	Plugins map[string]LockEntry `yaml:"plugins"`
+}
+
+// ReadLock reads the lock file. An empty lock is returned if the file does not
+// exist.
+func ReadLock(path string) (*Lock, error) {
+	lock := &Lock{Plugins: make(map[string]LockEntry)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading the lock file")
+	}
+
+	if err := yaml.Unmarshal(data, lock); err != nil {
+		return nil, errors.Wrap(err, "while parsing the lock file")
+	}
+	if lock.Plugins == nil {
+		lock.Plugins = make(map[string]LockEntry)
+	}
+
+	return lock, nil
+}
+
+// Write writes the lock file.
+func (l *Lock) Write(path string) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return errors.Wrap(err, "while serializing the lock file")
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return errors.Wrap(err, "while writing the lock file")
+	}
+	return nil
+}
+
+// MakeLock records the revisions of installed plugins. Plugins that are not
+// installed from Git repositories are not recorded.
+func (ps *PluginStorage) MakeLock() *Lock {
+	lock := &Lock{Plugins: make(map[string]LockEntry)}
+
+	for name, pse := range ps.Plugins {
+		g, ok := pse.Plugin.(gitBased)
+		if !ok {
+			continue
+		}
+		revision, err := g.gitPlugin().Revision()
+		if err == NotInstalled {
+			continue
+		} else if err != nil {
+			log.Errorf("while locking %s: %s", pse.Name, err)
+			continue
+		}
+		lock.Plugins[name] = LockEntry{Source: g.gitPlugin().Source(), Commit: revision}
+	}
+
+	return lock
+}
+
+// ApplyLock makes plugins check out the revisions recorded in the lock instead
+// of the configured ones, even if the plugins were rolled back. Must be called
+// before checking for updates. Fails
+// without changing plugins when a plugin installed from a Git repository is
+// not locked or is locked with a different source.
+func (ps *PluginStorage) ApplyLock(lock *Lock) error {
+	names := make([]string, 0, len(ps.Plugins))
+	for name := range ps.Plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	pins := make(map[*pluginStorageEntry]string)
+	for _, name := range names {
+		g, ok := ps.Plugins[name].Plugin.(gitBased)
+		if !ok {
+			continue
+		}
+		entry, ok := lock.Plugins[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s is not locked", name))
+			continue
+		}
+		if entry.Source != g.gitPlugin().Source() {
+			problems = append(problems, fmt.Sprintf("%s is locked with a different source %s", name, entry.Source))
+			continue
+		}
+		pins[ps.Plugins[name]] = entry.Commit
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("the lock file does not match the configuration: %s", strings.Join(problems, ", "))
+	}
+
+	for pse, commit := range pins {
+		pse.Plugin.(gitBased).gitPlugin().pin(commit)
+		pse.pinned = true
+	}
+	return nil
+}
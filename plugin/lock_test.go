@@ -0,0 +1,154 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Feature: Lock file
+//   Scenario: Lock installed plugins
+//     Given that a plugin is installed from a Git repository
+//     When the lock is made, written and read back
+//     Then it contains the source and the current commit of the plugin
+//     And plugins that are not versioned are not locked
+func TestLockRoundTrip(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	ps, err := MakePluginStorage(tempDir, []Config{
+		{Spec: "github.com/username/repo"},
+		{Spec: "github.com/username/missing"},
+		{Spec: "dir://local"},
+	})
+	require.Empty(t, err, "cannot create the plugin storage")
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	hash := makeTestCommit(t, repoPath, "repo.plugin.zsh", "initial commit")
+
+	lockPath := filepath.Join(tempDir, "zpm.lock")
+	err = ps.MakeLock().Write(lockPath)
+	require.Empty(t, err, "cannot write the lock")
+
+	lock, err := ReadLock(lockPath)
+	require.Empty(t, err, "cannot read the lock")
+
+	expected := map[string]LockEntry{
+		"github.com/username/repo": {
+			Source: "https://github.com/username/repo.git",
+			Commit: hash.String(),
+		},
+	}
+	assert.Equal(t, expected, lock.Plugins, "invalid lock")
+}
+
+//   Scenario: Missing lock file
+//     When the lock file does not exist
+//     Then an empty lock is returned
+func TestReadLockMissing(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	lock, err := ReadLock(filepath.Join(tempDir, "zpm.lock"))
+	require.Empty(t, err, "cannot read a missing lock")
+	assert.Empty(t, lock.Plugins, "the lock must be empty")
+}
+
+//   Scenario: Install locked revisions
+//     Given that a plugin is locked at an older commit
+//     When the lock is applied and the plugin is updated
+//     Then the locked commit is checked out
+func TestApplyLock(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: "github.com/username/repo"}})
+	require.Empty(t, err, "cannot create the plugin storage")
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	lockedHash := makeTestCommit(t, repoPath, "repo.plugin.zsh", "initial commit")
+	makeTestCommit(t, repoPath, "repo.plugin.zsh", "second commit")
+
+	err = ps.ApplyLock(&Lock{Plugins: map[string]LockEntry{
+		"github.com/username/repo": {
+			Source: "https://github.com/username/repo.git",
+			Commit: lockedHash.String(),
+		},
+	}})
+	require.Empty(t, err, "cannot apply the lock")
+
+	ps.CheckPluginUpdates(true)
+	assert.True(t, ps.HasUpdates(), "the plugin must be moved to the locked commit")
+	ps.UpdateAll()
+
+	revision, err := ps.Plugins["github.com/username/repo"].Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.Equal(t, lockedHash.String(), revision, "the locked commit must be checked out")
+}
+
+//   Scenario: Incomplete lock
+//     Given that a plugin is not locked
+//     And another plugin is locked with a different source
+//     When the lock is applied
+//     Then it fails
+//     And the configured revisions are kept
+func TestApplyLockIncomplete(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	configs := []Config{{Spec: "github.com/username/repo"}, {Spec: "github.com/username/other"}}
+	ps, err := MakePluginStorage(tempDir, configs)
+	require.Empty(t, err, "cannot create the plugin storage")
+
+	err = ps.ApplyLock(&Lock{Plugins: map[string]LockEntry{
+		"github.com/username/repo": {
+			Source: "https://github.com/fork/repo.git",
+			Commit: "0123456789abcdef0123456789abcdef01234567",
+		},
+	}})
+	require.NotEmpty(t, err, "an incomplete lock must be rejected")
+	assert.Contains(t, err.Error(), "github.com/username/other is not locked")
+	assert.Contains(t, err.Error(), "github.com/username/repo is locked with a different source")
+	p := ps.Plugins["github.com/username/repo"].Plugin.(gitBased).gitPlugin()
+	assert.Equal(t, "master", p.requiredRevision, "the configured revision must be kept")
+}
+
+//   Scenario: Install locked revisions of rolled back plugins
+//     Given that a plugin was rolled back
+//     When the lock is applied and the plugin is updated
+//     Then the locked commit is checked out
+func TestApplyLockFrozen(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: "github.com/username/repo"}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	pse := ps.Plugins["github.com/username/repo"]
+	require.Empty(t, pse.history.setFrozen(pse.Name, true))
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	lockedHash := makeTestCommit(t, repoPath, "repo.plugin.zsh", "initial commit")
+	makeTestCommit(t, repoPath, "repo.plugin.zsh", "second commit")
+
+	err = ps.ApplyLock(&Lock{Plugins: map[string]LockEntry{
+		"github.com/username/repo": {
+			Source: "https://github.com/username/repo.git",
+			Commit: lockedHash.String(),
+		},
+	}})
+	require.Empty(t, err, "cannot apply the lock")
+
+	ps.CheckPluginUpdates(true)
+	assert.True(t, ps.HasUpdates(), "the frozen plugin must be moved to the locked commit")
+	ps.UpdateAll()
+
+	revision, err := pse.Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.Equal(t, lockedHash.String(), revision, "the locked commit must be checked out")
+}
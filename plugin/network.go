@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+// The delay before the first retry of a failed network operation. Every next
+// delay is two times longer.
+var retryDelay = time.Second
+
+// NetworkOptions limit network operations of plugins installed from Git
+// repositories.
+type NetworkOptions struct {
+	// The maximum duration of a single fetch or clone. Zero means no limit.
+	Timeout time.Duration
+	// The number of times an operation failed with a transient error is
+	// retried.
+	Retries int
+	// Cancels the operations in progress when it is done, e.g. when zpm is
+	// interrupted. Nil means the operations are never cancelled.
+	Context context.Context
+}
+
+// parent returns the context all operations are cancelled with.
+func (o *NetworkOptions) parent() context.Context {
+	if o == nil || o.Context == nil {
+		return context.Background()
+	}
+	return o.Context
+}
+
+// context returns the context a single attempt of an operation runs with.
+func (o *NetworkOptions) context() (context.Context, context.CancelFunc) {
+	if o == nil || o.Timeout == 0 {
+		return context.WithCancel(o.parent())
+	}
+	return context.WithTimeout(o.parent(), o.Timeout)
+}
+
+// interrupted tells whether new operations must not be started.
+func (o *NetworkOptions) interrupted() bool {
+	return o.parent().Err() != nil
+}
+
+// isTransient tells whether a failed network operation may succeed when it is
+// retried.
+func isTransient(err error) bool {
+	err = errors.Cause(err)
+	if unexpected, ok := err.(*plumbing.UnexpectedError); ok {
+		err = unexpected.Err
+	}
+
+	switch err {
+	case context.DeadlineExceeded, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	case transport.ErrRepositoryNotFound,
+		transport.ErrEmptyRemoteRepository,
+		transport.ErrAuthenticationRequired,
+		transport.ErrAuthorizationFailed,
+		transport.ErrInvalidAuthMethod:
+		return false
+	}
+
+	switch err := err.(type) {
+	case net.Error:
+		return true
+	case *http.Err:
+		// server errors and rate limiting
+		return err.StatusCode() >= 500 || err.StatusCode() == 429
+	}
+	return false
+}
+
+// retry runs a network operation with the configured timeout and retries it
+// with an exponential backoff while it fails with transient errors.
+func (p *Git) retry(operation string, f func(ctx context.Context) error) error {
+	retries := 0
+	if p.network != nil {
+		retries = p.network.Retries
+	}
+
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := p.network.context()
+		err := f(ctx)
+		if err != nil && p.network.interrupted() {
+			cancel()
+			return ErrInterrupted
+		}
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			err = errors.Wrapf(context.DeadlineExceeded, "timed out after %s", p.network.Timeout)
+		}
+		cancel()
+
+		if err == nil || !isTransient(err) || attempt >= retries {
+			return err
+		}
+		log.Warnf(
+			"%s %s failed (attempt %d of %d): %s, retrying in %s",
+			operation,
+			p.URL,
+			attempt+1,
+			retries+1,
+			err,
+			delay,
+		)
+		select {
+		case <-time.After(delay):
+		case <-p.network.parent().Done():
+			return ErrInterrupted
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// Feature: Network operations
+//   Scenario: Classify errors
+func TestIsTransient(t *testing.T) {
+	assert.True(t, isTransient(io.ErrUnexpectedEOF))
+	assert.True(t, isTransient(errors.Wrap(context.DeadlineExceeded, "timed out")))
+	assert.False(t, isTransient(transport.ErrRepositoryNotFound))
+	assert.False(t, isTransient(transport.ErrAuthenticationRequired))
+	assert.False(t, isTransient(errors.New("failed to get the revision")))
+}
+
+//   Scenario: Retry transient failures
+//     Given an operation failing with transient errors
+//     When it is run with retries
+//     Then it is repeated until it succeeds or the retries are exhausted
+func TestRetry(t *testing.T) {
+	retryDelay = 0
+	defer func() { retryDelay = time.Second }()
+
+	plugin := NewGit("github.com/username/repo", "master", "")
+	plugin.network = &NetworkOptions{Retries: 2}
+
+	attempts := 0
+	err := plugin.retry("fetching", func(context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	})
+	assert.Empty(t, err, "the last attempt must succeed")
+	assert.Equal(t, 3, attempts, "invalid number of attempts")
+
+	attempts = 0
+	err = plugin.retry("fetching", func(context.Context) error {
+		attempts++
+		return io.ErrUnexpectedEOF
+	})
+	assert.Equal(t, io.ErrUnexpectedEOF, err, "the last error must be returned")
+	assert.Equal(t, 3, attempts, "invalid number of attempts")
+
+	attempts = 0
+	err = plugin.retry("fetching", func(context.Context) error {
+		attempts++
+		return transport.ErrRepositoryNotFound
+	})
+	assert.Equal(t, transport.ErrRepositoryNotFound, err, "the error must be returned")
+	assert.Equal(t, 1, attempts, "permanent errors must not be retried")
+}
+
+//   Scenario: Time out hung operations
+func TestRetryTimeout(t *testing.T) {
+	retryDelay = 0
+	defer func() { retryDelay = time.Second }()
+
+	plugin := NewGit("github.com/username/repo", "master", "")
+	plugin.network = &NetworkOptions{Timeout: time.Millisecond, Retries: 1}
+
+	attempts := 0
+	err := plugin.retry("fetching", func(ctx context.Context) error {
+		attempts++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err), "the operation must time out")
+	assert.Equal(t, 2, attempts, "timeouts must be retried")
+}
+
+//   Scenario: Limit the number of parallel jobs
+func TestForEachJobs(t *testing.T) {
+	ps := &PluginStorage{Plugins: make(map[string]*pluginStorageEntry), Jobs: 2}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		ps.Plugins[name] = &pluginStorageEntry{Name: name}
+	}
+
+	mutex := sync.Mutex{}
+	running, maxRunning, visited := 0, 0, 0
+	ps.forEach(func(*pluginStorageEntry) {
+		mutex.Lock()
+		running++
+		visited++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+	})
+
+	assert.Equal(t, 5, visited, "all plugins must be visited")
+	assert.Equal(t, 2, maxRunning, "invalid number of parallel jobs")
+}
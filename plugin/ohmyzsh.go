@@ -1,7 +1,9 @@
 package plugin
 
 import (
-	"fmt"
+	"github.com/eugene-babichenko/zpm/zsh"
+
+	"os"
 	"path/filepath"
 
 	"github.com/pkg/errors"
@@ -56,11 +58,13 @@ func (p *OhMyZsh) Load() (fpath []string, exec []string, err error) {
 	}
 
 	// load zsh library files
-	libraries := fmt.Sprintf(
-		"for config_file (%s/lib/*.zsh); do source $config_file; done",
-		p.git.Dir.Path,
-	)
-	exec = append(exec, libraries)
+	libraries, err := matchFiles(filepath.Join(p.git.Dir.Path, "lib"), "*.zsh")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, errors.Wrap(err, "ohmyzsh")
+	}
+	for _, library := range libraries {
+		exec = append(exec, zsh.Source(library))
+	}
 
 	return fpath, exec, nil
 }
@@ -86,3 +90,7 @@ func (p *OhMyZsh) LoadTheme(name string) Dir {
 func (p *OhMyZsh) IsInstalled() (installed bool, err error) {
 	return p.git.IsInstalled()
 }
+
+func (p *OhMyZsh) gitPlugin() *Git {
+	return &p.git
+}
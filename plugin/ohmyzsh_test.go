@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -76,3 +77,32 @@ func TestMakeOhMyZshThemeNoName(t *testing.T) {
 	_, err = (*ohmyzsh).(*OhMyZsh).MakeTheme(tempDir, map[string]string{})
 	assert.NotEmpty(t, err, "must return an error")
 }
+
+//   Scenario: Load Oh My Zsh
+//     Given that Oh My Zsh is installed
+//     When the `Load` function is called
+//     Then every library file is sourced
+func TestOhMyZshLoad(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	ohmyzsh, _ := MakeOhMyZsh(tempDir, map[string]string{})
+	libDir := filepath.Join(tempDir, "github.com/robbyrussell/oh-my-zsh/lib")
+	err = os.MkdirAll(libDir, os.ModePerm)
+	require.Empty(t, err, "cannot create lib dir")
+
+	files := []string{"completion.zsh", "history.zsh"}
+	for _, filename := range files {
+		_, err = os.Create(filepath.Join(libDir, filename))
+		require.Empty(t, err, "cannot create library file")
+	}
+
+	_, exec, err := (*ohmyzsh).Load()
+	require.Empty(t, err, "cannot load Oh My Zsh")
+
+	sourceLines := make([]string, 0)
+	for _, filename := range files {
+		sourceLines = append(sourceLines, "source "+filepath.Join(libDir, filename))
+	}
+	assert.Equal(t, sourceLines, exec, "invalid exec lines")
+}
@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Outdated describes an available update of a plugin.
+type Outdated struct {
+	Name string `json:"name"`
+	// The installed commit.
+	Current string `json:"current"`
+	// The commit the update checks out. Empty if it is not known yet, e.g.
+	// when the full history must be cloned first.
+	Target string `json:"target,omitempty"`
+	// The number of commits brought by the update.
+	Behind int `json:"behind"`
+	// The date of the newest commit brought by the update.
+	NewestCommit *time.Time `json:"newest_commit,omitempty"`
+	// False when installed commits are discarded by the update, e.g. when an
+	// older revision is required.
+	FastForward bool `json:"fast_forward"`
+}
+
+// Outdated describes the updates found by `CheckPluginUpdates` in the load
+// order.
+func (ps *PluginStorage) Outdated() []Outdated {
+	list := []Outdated{}
+	for _, name := range ps.LoadOrder {
+		pse := ps.Plugins[name]
+		if !pse.HasUpdate() {
+			continue
+		}
+		entry := Outdated{Name: name}
+		entry.Current, _ = pse.Revision()
+
+		if g, ok := pse.Plugin.(gitBased); ok && g.gitPlugin().update != nil {
+			p := g.gitPlugin()
+			entry.Target = p.update.String()
+			if err := entry.countCommits(p); err != nil {
+				log.Errorf("while comparing the revisions of %s: %s", name, err)
+			}
+		}
+		list = append(list, entry)
+	}
+	return list
+}
+
+func (entry *Outdated) countCommits(p *Git) error {
+	from, to, err := p.updateCommits()
+	if err != nil {
+		return err
+	}
+	commits, fastForward, err := newCommits(from, to)
+	if err != nil {
+		return err
+	}
+	entry.Behind = len(commits)
+	entry.FastForward = fastForward
+	if len(commits) > 0 {
+		entry.NewestCommit = &commits[0].Date
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4"
+)
+
+// Feature: Outdated plugins
+//   Scenario: Report an update bringing new commits
+//     Given that an older commit of a plugin is checked out
+//     And a newer commit is required
+//     When the plugins are checked
+//     Then the update lists the number of new commits and the newest commit date
+func TestOutdatedFastForward(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	first := makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+	makeTestCommit(t, repoPath, "repo.plugin.zsh", "second commit")
+	third := makeTestCommit(t, repoPath, "repo.plugin.zsh", "third commit")
+
+	repository, err := git.PlainOpen(repoPath)
+	require.Empty(t, err, "cannot open the repository")
+	worktree, err := repository.Worktree()
+	require.Empty(t, err, "cannot open the worktree")
+	err = worktree.Checkout(&git.CheckoutOptions{Hash: first})
+	require.Empty(t, err, "cannot check out the first commit")
+	newest, err := repository.CommitObject(third)
+	require.Empty(t, err, "cannot read a commit")
+
+	spec := "github.com/username/repo@" + third.String()
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: spec}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	ps.CheckPluginUpdates(true)
+
+	list := ps.Outdated()
+	require.Len(t, list, 1, "the update must be reported")
+	assert.Equal(t, spec, list[0].Name, "invalid name")
+	assert.Equal(t, first.String(), list[0].Current, "invalid current revision")
+	assert.Equal(t, third.String(), list[0].Target, "invalid target revision")
+	assert.Equal(t, 2, list[0].Behind, "invalid number of commits")
+	assert.True(t, list[0].FastForward, "must be a fast-forward update")
+	require.NotNil(t, list[0].NewestCommit, "the newest commit must be reported")
+	assert.True(t, newest.Author.When.Equal(*list[0].NewestCommit), "invalid newest commit date")
+}
+
+//   Scenario: Report moving to an older revision
+//     Given that a plugin requires an older commit than the installed one
+//     When the plugins are checked
+//     Then the update does not bring commits
+//     And it is not a fast-forward one
+func TestOutdatedNotFastForward(t *testing.T) {
+	tempDir, ps, _, target := makeModifiedPlugin(t)
+	defer os.RemoveAll(tempDir)
+	ps.CheckPluginUpdates(true)
+
+	list := ps.Outdated()
+	require.Len(t, list, 1, "the update must be reported")
+	assert.Equal(t, target, list[0].Target, "invalid target revision")
+	assert.Zero(t, list[0].Behind, "must not bring commits")
+	assert.False(t, list[0].FastForward, "must not be a fast-forward update")
+	assert.Nil(t, list[0].NewestCommit, "must not report the newest commit")
+}
+
+//   Scenario: Skip up-to-date plugins
+func TestOutdatedUpToDate(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	head := makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+
+	spec := "github.com/username/repo@" + head.String()
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: spec}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	ps.CheckPluginUpdates(true)
+
+	assert.Empty(t, ps.Outdated(), "up-to-date plugins must not be reported")
+}
@@ -16,6 +16,9 @@ var UpToDate = errors.New("up to date")
 
 var NotInstallable = errors.New("this plugin cannot be installed from the external source")
 
+// Returned by operations cancelled because zpm is interrupted.
+var ErrInterrupted = errors.New("interrupted")
+
 // Check if a plugin is not installed with the error value of
 // `Plugin.CheckUpdate`.
 func IsNotInstalled(err error) bool {
@@ -53,3 +56,10 @@ type Plugin interface {
 	// IsInstalled checks if the plugin is actually installed.
 	IsInstalled() (installed bool, err error)
 }
+
+// gitBased is implemented by plugins that are installed from a Git repository.
+// It allows the storage to get to the repository-specific data without
+// extending the universal `Plugin` interface.
+type gitBased interface {
+	gitPlugin() *Git
+}
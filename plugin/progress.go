@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Progress receives the progress of operations on plugins. Plugins are checked
+// and installed in parallel, so implementations must be safe for concurrent
+// use.
+type Progress interface {
+	// Phase is called when a plugin starts a new phase of an operation, like
+	// "fetching" or "checking out". The detail is the last progress message of
+	// the phase (e.g. the number of objects received from the remote) and can
+	// be empty.
+	Phase(name string, phase string, detail string)
+	// Finish is called when an operation on a plugin is finished.
+	Finish(name string, result string)
+}
+
+// reportPhase reports the phase of an operation to the storage progress.
+func (pse *pluginStorageEntry) reportPhase(phase string, detail string) {
+	if pse.storage != nil && pse.storage.Progress != nil {
+		pse.storage.Progress.Phase(pse.Name, phase, detail)
+	}
+}
+
+// reportFinish reports the result of an operation to the storage progress.
+func (pse *pluginStorageEntry) reportFinish(result string) {
+	if pse.storage != nil && pse.storage.Progress != nil {
+		pse.storage.Progress.Finish(pse.Name, result)
+	}
+}
+
+// reportPhase reports the phase of an operation on the repository.
+func (p *Git) reportPhase(phase string, detail string) {
+	if p.progress != nil {
+		p.progress(phase, detail)
+	}
+}
+
+// sidebandWriter passes the progress messages sent by the remote as the
+// details of the phase. The messages are separated by carriage returns when a
+// line is updated in place.
+type sidebandWriter struct {
+	phase  string
+	report func(phase string, detail string)
+	buffer []byte
+}
+
+// sideband returns the writer for the progress messages of the remote. When the
+// progress is not reported, nil is returned, so the remote does not send the
+// messages at all.
+func (p *Git) sideband(phase string) io.Writer {
+	if p.progress == nil {
+		return nil
+	}
+	return &sidebandWriter{phase: phase, report: p.progress}
+}
+
+func (w *sidebandWriter) Write(data []byte) (int, error) {
+	w.buffer = append(w.buffer, data...)
+	for {
+		end := bytes.IndexAny(w.buffer, "\r\n")
+		if end < 0 {
+			return len(data), nil
+		}
+		line := strings.TrimSpace(string(w.buffer[:end]))
+		w.buffer = w.buffer[end+1:]
+		if line != "" {
+			w.report(w.phase, line)
+		}
+	}
+}
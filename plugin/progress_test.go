@@ -0,0 +1,31 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Feature: Progress reporting
+//   Scenario: Pass the progress messages of a remote
+//     Given a remote sending progress messages updated in place
+//     When they are written to the sideband writer
+//     Then every complete message is reported as the detail of the phase
+func TestSidebandWriter(t *testing.T) {
+	var details []string
+	p := &Git{progress: func(phase string, detail string) {
+		assert.Equal(t, "fetching", phase)
+		details = append(details, detail)
+	}}
+	w := p.sideband("fetching")
+
+	w.Write([]byte("Counting objects:  50% (1/2)\rCounting objects: 100% (2/2)"))
+	w.Write([]byte(", done.\nTotal 2 (delta 0)\n"))
+	assert.Equal(
+		t,
+		[]string{"Counting objects:  50% (1/2)", "Counting objects: 100% (2/2), done.", "Total 2 (delta 0)"},
+		details,
+	)
+
+	assert.Nil(t, (&Git{}).sideband("fetching"))
+}
@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// History returns the revisions replaced by updates from the oldest to the
+// newest.
+func (pse *pluginStorageEntry) History() []HistoryEntry {
+	return pse.history.entries(pse.Name)
+}
+
+// IsFrozen tells whether the plugin was rolled back and is not updated until
+// it is updated explicitly.
+func (pse *pluginStorageEntry) IsFrozen() bool {
+	return pse.history.isFrozen(pse.Name)
+}
+
+// AllowUpdate makes the next check find the update of a plugin that was rolled
+// back. The plugin is unfrozen only after it is updated or found up to date, so
+// a failed or skipped update keeps it frozen.
+func (pse *pluginStorageEntry) AllowUpdate() {
+	pse.unfreeze = true
+}
+
+// finishUnfreeze unfreezes a plugin allowed to be updated by `AllowUpdate` once
+// it is at the configured revision.
+func (pse *pluginStorageEntry) finishUnfreeze() {
+	if !pse.unfreeze {
+		return
+	}
+	pse.unfreeze = false
+	if err := pse.history.setFrozen(pse.Name, false); err != nil {
+		log.Errorf("while unfreezing %s: %s", pse.Name, err)
+	}
+}
+
+// checkout installs the revision without recording it in the history.
+func (pse *pluginStorageEntry) checkout(revision string) error {
+	g, ok := pse.Plugin.(gitBased)
+	if !ok {
+		return ErrNotUpgradable
+	}
+
+	p := g.gitPlugin()
+	p.pin(revision)
+	_, err := p.CheckUpdate(true)
+	if IsUpToDate(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !pse.applyLocalChangesPolicy() {
+		return ErrLocalChanges
+	}
+	return p.InstallUpdate()
+}
+
+// Rollback restores the revision that was installed before the last `steps`
+// updates and freezes the plugin.
+func (pse *pluginStorageEntry) Rollback(steps int) error {
+	entries := pse.History()
+	if steps < 1 {
+		return errors.New("the number of steps must be positive")
+	}
+	if len(entries) < steps {
+		return fmt.Errorf("%s has only %d recorded updates", pse.Name, len(entries))
+	}
+
+	revision := entries[len(entries)-steps].Revision
+	if err := pse.checkout(revision); err != nil {
+		return errors.Wrapf(err, "while rolling back %s", pse.Name)
+	}
+	pse.state = pluginInstalled
+	pse.recordState(false, true)
+
+	return pse.history.rollback(pse.Name, steps)
+}
+
+// RollbackTo installs the revision (a branch, a tag or a commit hash) and
+// freezes the plugin. The replaced revision is recorded, so it can be restored
+// with `Rollback`.
+func (pse *pluginStorageEntry) RollbackTo(revision string) error {
+	previousRevision, revisionErr := pse.Revision()
+	if err := pse.checkout(revision); err != nil {
+		return errors.Wrapf(err, "while rolling back %s", pse.Name)
+	}
+	pse.state = pluginInstalled
+	pse.recordState(false, true)
+
+	if current, err := pse.Revision(); revisionErr == nil && err == nil && current != previousRevision {
+		if err := pse.history.record(pse.Name, previousRevision); err != nil {
+			return err
+		}
+	}
+	return pse.history.rollback(pse.Name, 0)
+}
@@ -0,0 +1,125 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Feature: Rollbacks
+//   Scenario: Roll back the last update
+//     Given that a plugin was updated
+//     When it is rolled back
+//     Then the previous revision is checked out
+//     And the plugin is frozen
+//     And the plugin is not updated until it is updated explicitly
+func TestRollback(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	first := makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+	second := makeTestCommit(t, repoPath, "repo.plugin.zsh", "second commit")
+
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: "github.com/username/repo@" + first.String()}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	pse := ps.Plugins["github.com/username/repo@"+first.String()]
+
+	// move to the first commit, so the second one is recorded
+	pse.CheckPluginUpdate(true)
+	pse.Update()
+	require.Len(t, pse.History(), 1, "the update must be recorded")
+	assert.Equal(t, second.String(), pse.History()[0].Revision, "invalid recorded revision")
+
+	err = pse.Rollback(1)
+	require.Empty(t, err, "cannot roll back")
+
+	revision, err := pse.Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.Equal(t, second.String(), revision, "the previous revision must be checked out")
+	assert.Empty(t, pse.History(), "the history must be truncated")
+	assert.True(t, pse.IsFrozen(), "the plugin must be frozen")
+
+	// the history survives between runs
+	ps, err = MakePluginStorage(tempDir, []Config{{Spec: "github.com/username/repo@" + first.String()}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	pse = ps.Plugins["github.com/username/repo@"+first.String()]
+	assert.True(t, pse.IsFrozen(), "the plugin must stay frozen")
+
+	ps.CheckPluginUpdates(true)
+	assert.False(t, ps.HasUpdates(), "frozen plugins must not be updated")
+
+	// a skipped update keeps the plugin frozen
+	err = ioutil.WriteFile(filepath.Join(repoPath, "repo.plugin.zsh"), []byte("local hack\n"), os.ModePerm)
+	require.Empty(t, err, "cannot modify the plugin")
+	pse.AllowUpdate()
+	pse.CheckPluginUpdate(true)
+	assert.True(t, pse.HasUpdate(), "explicitly updated plugins must be updated")
+	pse.Update()
+	assert.True(t, pse.IsFrozen(), "the plugin must stay frozen after a skipped update")
+
+	err = ioutil.WriteFile(filepath.Join(repoPath, "repo.plugin.zsh"), []byte("second commit"), os.ModePerm)
+	require.Empty(t, err, "cannot restore the plugin")
+	pse.AllowUpdate()
+	pse.CheckPluginUpdate(true)
+	pse.Update()
+	revision, err = pse.Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.Equal(t, first.String(), revision, "the plugin must be updated")
+	assert.False(t, pse.IsFrozen(), "the plugin must be unfrozen after the update")
+}
+
+//   Scenario: Roll back more steps than recorded
+//     When a plugin is rolled back more steps than it was updated
+//     Then an error is returned
+func TestRollbackTooManySteps(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: "github.com/username/repo"}})
+	require.Empty(t, err, "cannot create the plugin storage")
+
+	err = ps.Plugins["github.com/username/repo"].Rollback(1)
+	assert.NotEmpty(t, err, "must return an error")
+}
+
+//   Scenario: Roll back to a revision
+//     When a plugin is rolled back to a revision
+//     Then the revision is checked out
+//     And the plugin is frozen
+//     And the replaced revision can be restored by rolling back
+func TestRollbackTo(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	first := makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+	second := makeTestCommit(t, repoPath, "repo.plugin.zsh", "second commit")
+
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: "github.com/username/repo"}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	pse := ps.Plugins["github.com/username/repo"]
+
+	err = pse.RollbackTo(first.String())
+	require.Empty(t, err, "cannot roll back")
+
+	revision, err := pse.Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.Equal(t, first.String(), revision, "the revision must be checked out")
+	assert.True(t, pse.IsFrozen(), "the plugin must be frozen")
+
+	require.Len(t, pse.History(), 1, "the replaced revision must be recorded")
+	assert.Equal(t, second.String(), pse.History()[0].Revision, "invalid recorded revision")
+
+	require.Empty(t, pse.Rollback(1), "cannot undo the rollback")
+	revision, err = pse.Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.Equal(t, second.String(), revision, "the replaced revision must be restored")
+}
@@ -0,0 +1,99 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// latestTag is the required revision selecting the tag with the highest stable
+// version.
+const latestTag = "latest-tag"
+
+// isVersionConstraint tells whether the required revision is a semantic version
+// constraint (like `^1.2` or `~0.4.1`) instead of a branch, a tag or a commit
+// hash.
+func isVersionConstraint(revision string) bool {
+	if revision == latestTag {
+		return true
+	}
+	return revision != "" && strings.ContainsAny(revision[:1], "^~<>=!")
+}
+
+// noMatchingTagsError is returned when no version tag satisfies a constraint.
+type noMatchingTagsError struct {
+	constraint string
+}
+
+func (e *noMatchingTagsError) Error() string {
+	return fmt.Sprintf("no tags matching %s", e.constraint)
+}
+
+// resolveVersionConstraint finds the tag with the highest semantic version
+// satisfying the constraint. Tags that are not versions are ignored, as well as
+// pre-releases unless the constraint explicitly allows them. The name of the
+// tag and its commit hash are returned.
+func resolveVersionConstraint(
+	repository *git.Repository,
+	constraint string,
+) (string, *plumbing.Hash, error) {
+	var constraints *semver.Constraints
+	if constraint != latestTag {
+		var err error
+		constraints, err = semver.NewConstraint(constraint)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "invalid version constraint %s", constraint)
+		}
+	}
+
+	tags, err := repository.Tags()
+	if err != nil {
+		return "", nil, errors.Wrap(err, "while reading tags")
+	}
+
+	var bestVersion *semver.Version
+	var bestTag *plumbing.Reference
+	err = tags.ForEach(func(tag *plumbing.Reference) error {
+		version, err := semver.NewVersion(tag.Name().Short())
+		if err != nil {
+			// not a version tag
+			return nil
+		}
+		if constraints == nil && version.Prerelease() != "" {
+			return nil
+		}
+		if constraints != nil && !constraints.Check(version) {
+			return nil
+		}
+		if bestVersion == nil || version.GreaterThan(bestVersion) {
+			bestVersion = version
+			bestTag = tag
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, errors.Wrap(err, "while reading tags")
+	}
+	if bestTag == nil {
+		return "", nil, &noMatchingTagsError{constraint: constraint}
+	}
+
+	hash := bestTag.Hash()
+	// annotated tags point to tag objects instead of commits
+	tagObject, err := repository.TagObject(hash)
+	if err == nil {
+		commit, err := tagObject.Commit()
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "while resolving tag %s", bestTag.Name().Short())
+		}
+		hash = commit.Hash
+	} else if err != plumbing.ErrObjectNotFound {
+		return "", nil, errors.Wrapf(err, "while resolving tag %s", bestTag.Name().Short())
+	}
+
+	return bestTag.Name().Short(), &hash, nil
+}
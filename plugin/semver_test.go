@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Feature: Semantic version constraints
+//   Scenario: Resolve constraints against tags
+//     Given a repository with lightweight and annotated version tags
+//     When a plugin requires a version constraint
+//     Then the tag with the highest matching version is selected
+//     And pre-releases and tags that are not versions are ignored
+func TestVersionConstraints(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	plugin := NewGit("github.com/username/repo", "master", tempDir)
+	v100 := makeTestCommit(t, plugin.Dir.Path, "repo.plugin.zsh", "v1.0.0")
+	v120 := makeTestCommit(t, plugin.Dir.Path, "repo.plugin.zsh", "v1.2.0")
+	v131 := makeTestCommit(t, plugin.Dir.Path, "repo.plugin.zsh", "v1.3.1")
+	v200 := makeTestCommit(t, plugin.Dir.Path, "repo.plugin.zsh", "v2.0.0")
+	v300rc := makeTestCommit(t, plugin.Dir.Path, "repo.plugin.zsh", "v3.0.0-rc1")
+
+	repository, err := git.PlainOpen(plugin.Dir.Path)
+	require.Empty(t, err, "cannot open the test repository")
+	annotated := &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "zpm", Email: "zpm@example.com", When: time.Now()},
+		Message: "release",
+	}
+	tags := []struct {
+		name string
+		opts *git.CreateTagOptions
+	}{
+		{"v1.0.0", nil},
+		{"v1.2.0", annotated},
+		{"1.3.1", nil},
+		{"v2.0.0", annotated},
+		{"v3.0.0-rc1", nil},
+		{"stable", nil},
+	}
+	hashes := map[string]string{
+		"v1.0.0":     v100.String(),
+		"v1.2.0":     v120.String(),
+		"1.3.1":      v131.String(),
+		"v2.0.0":     v200.String(),
+		"v3.0.0-rc1": v300rc.String(),
+		"stable":     v100.String(),
+	}
+	for _, tag := range tags {
+		_, err := repository.CreateTag(tag.name, plumbing.NewHash(hashes[tag.name]), tag.opts)
+		require.Empty(t, err, "cannot create tag %s", tag.name)
+	}
+
+	cases := []struct {
+		constraint string
+		tag        string
+	}{
+		{"^1.2", "1.3.1"},
+		{"~1.2", "v1.2.0"},
+		{"<1.2", "v1.0.0"},
+		{">=2", "v2.0.0"},
+		{latestTag, "v2.0.0"},
+		{">=3.0.0-rc", "v3.0.0-rc1"},
+	}
+	for _, c := range cases {
+		tag, hash, err := resolveVersionConstraint(repository, c.constraint)
+		require.Empty(t, err, "cannot resolve %s", c.constraint)
+		assert.Equal(t, c.tag, tag, "wrong tag for %s", c.constraint)
+		assert.Equal(t, hashes[c.tag], hash.String(), "wrong commit for %s", c.constraint)
+	}
+
+	_, _, err = resolveVersionConstraint(repository, "^4")
+	assert.NotEmpty(t, err, "unsatisfiable constraints must fail")
+
+	// the plugin is checked out at the selected tag
+	plugin.requiredRevision = "~1.2"
+	update, err := plugin.CheckUpdate(true)
+	require.Empty(t, err, "cannot check for an update")
+	assert.Contains(t, *update, "~1.2 (v1.2.0)", "the tag must be reported")
+	err = plugin.InstallUpdate()
+	require.Empty(t, err, "cannot install the update")
+
+	revision, err := plugin.Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.Equal(t, v120.String(), revision, "wrong revision")
+}
+
+//   Scenario: Tell constraints from revisions
+func TestIsVersionConstraint(t *testing.T) {
+	assert.True(t, isVersionConstraint("^1.2"))
+	assert.True(t, isVersionConstraint("~0.4.1"))
+	assert.True(t, isVersionConstraint(">=1.0, <2.0"))
+	assert.True(t, isVersionConstraint(latestTag))
+	assert.False(t, isVersionConstraint("master"))
+	assert.False(t, isVersionConstraint("v1.0"))
+	assert.False(t, isVersionConstraint(""))
+}
@@ -0,0 +1,170 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// sparseIncludes tells whether a file is a part of a sparse checkout. Like in
+// the cone mode of Git, files in the root directory are always included, as
+// well as everything inside of the listed directories.
+func sparseIncludes(paths []string, name string) bool {
+	if !strings.Contains(name, "/") {
+		return true
+	}
+	for _, path := range paths {
+		if strings.HasPrefix(name, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkoutSparse replaces the files of the installed revision with the files
+// of the commit included in the sparse checkout and moves HEAD to the commit.
+//
+// go-git cannot write the skip-worktree flags of a sparse index, so the files
+// are written directly from the commit tree and the index lists only the files
+// that were written.
+func (p *Git) checkoutSparse(hash plumbing.Hash) error {
+	commit, err := p.repository.CommitObject(hash)
+	if err != nil {
+		return errors.Wrap(err, "cannot read the target commit")
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return errors.Wrap(err, "cannot read the target tree")
+	}
+
+	// files of directories that are no longer required are removed as well
+	var removedDirs []string
+	if head, err := p.repository.Head(); err == nil {
+		installed, err := p.repository.CommitObject(head.Hash())
+		if err != nil {
+			return errors.Wrap(err, "cannot read the installed commit")
+		}
+		installedTree, err := installed.Tree()
+		if err != nil {
+			return errors.Wrap(err, "cannot read the installed tree")
+		}
+		err = installedTree.Files().ForEach(func(f *object.File) error {
+			err := os.Remove(filepath.Join(p.Dir.Path, filepath.FromSlash(f.Name)))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if dir := path.Dir(f.Name); dir != "." {
+				removedDirs = append(removedDirs, dir)
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "while removing installed files")
+		}
+	}
+
+	idx := &index.Index{Version: 2}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if !sparseIncludes(p.sparsePaths, f.Name) {
+			return nil
+		}
+		filename := filepath.Join(p.Dir.Path, filepath.FromSlash(f.Name))
+		if err := writeTreeFile(filename, f); err != nil {
+			return err
+		}
+		stat, err := os.Lstat(filename)
+		if err != nil {
+			return err
+		}
+		idx.Entries = append(idx.Entries, &index.Entry{
+			Hash:       f.Hash,
+			Name:       f.Name,
+			Mode:       f.Mode,
+			ModifiedAt: stat.ModTime(),
+			Size:       uint32(stat.Size()),
+		})
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "while writing files")
+	}
+	p.removeEmptyDirs(removedDirs)
+	if err := p.repository.Storer.SetIndex(idx); err != nil {
+		return errors.Wrap(err, "while writing the index")
+	}
+
+	head := plumbing.NewHashReference(plumbing.HEAD, hash)
+	if err := p.repository.Storer.SetReference(head); err != nil {
+		return errors.Wrap(err, "while updating HEAD")
+	}
+	return nil
+}
+
+// removeEmptyDirs removes the directories (relative to the plugin directory,
+// with slashes) and their parents that are left empty by a checkout.
+func (p *Git) removeEmptyDirs(dirs []string) {
+	// the deepest directories are removed first
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		for ; dir != "."; dir = path.Dir(dir) {
+			// directories that are not empty are kept
+			if err := os.Remove(filepath.Join(p.Dir.Path, filepath.FromSlash(dir))); err != nil {
+				break
+			}
+		}
+	}
+}
+
+// writeTreeFile writes the contents of a file from a commit tree to the path.
+func writeTreeFile(path string, f *object.File) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	mode, err := f.Mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+	contents, err := f.Contents()
+	if err != nil {
+		return err
+	}
+	if mode&os.ModeSymlink != 0 {
+		return os.Symlink(contents, path)
+	}
+	return ioutil.WriteFile(path, []byte(contents), mode.Perm())
+}
+
+// sparseIncomplete tells whether some of the directories required by a sparse
+// checkout are missing, e.g. because they were added to the configuration
+// after the plugin was installed.
+func (p *Git) sparseIncomplete(hash plumbing.Hash) (bool, error) {
+	if p.sparsePaths == nil {
+		return false, nil
+	}
+	commit, err := p.repository.CommitObject(hash)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot read the installed commit")
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return false, errors.Wrap(err, "cannot read the installed tree")
+	}
+	for _, path := range p.sparsePaths {
+		// directories that do not exist in the repository are not required
+		if _, err := tree.FindEntry(path); err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(p.Dir.Path, filepath.FromSlash(path))); os.IsNotExist(err) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4"
+)
+
+// Feature: Sparse checkouts
+//   Scenario: Include paths like the cone mode of Git
+func TestSparseIncludes(t *testing.T) {
+	paths := []string{"lib", "plugins/git"}
+	assert.True(t, sparseIncludes(paths, "oh-my-zsh.sh"), "root files must be included")
+	assert.True(t, sparseIncludes(paths, "lib/git.zsh"))
+	assert.True(t, sparseIncludes(paths, "plugins/git/git.plugin.zsh"))
+	assert.False(t, sparseIncludes(paths, "plugins/github/github.plugin.zsh"))
+	assert.False(t, sparseIncludes(paths, "themes/robbyrussell.zsh-theme"))
+}
+
+//   Scenario: Check out only the required directories
+//     Given a repository with plugins
+//     When a sparse checkout is performed
+//     Then only root files and the required directories are written
+//     And the directories required later are checked out by an update
+func TestCheckoutSparse(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+
+	plugin := NewGit("github.com/robbyrussell/oh-my-zsh", "master", tempDir)
+	for _, dir := range []string{"lib", "plugins/git", "plugins/github"} {
+		err := os.MkdirAll(filepath.Join(plugin.Dir.Path, dir), os.ModePerm)
+		require.Empty(t, err, "cannot create a test directory")
+	}
+	makeTestCommit(t, plugin.Dir.Path, "oh-my-zsh.sh", "root")
+	makeTestCommit(t, plugin.Dir.Path, "lib/git.zsh", "lib")
+	makeTestCommit(t, plugin.Dir.Path, "plugins/git/git.plugin.zsh", "git")
+	hash := makeTestCommit(t, plugin.Dir.Path, "plugins/github/github.plugin.zsh", "github")
+
+	// start from an empty worktree
+	for _, name := range []string{"oh-my-zsh.sh", "lib", "plugins"} {
+		require.Empty(t, os.RemoveAll(filepath.Join(plugin.Dir.Path, name)), "cannot clean the worktree")
+	}
+
+	plugin.repository, err = git.PlainOpen(plugin.Dir.Path)
+	require.Empty(t, err, "cannot open the test repository")
+	plugin.sparsePaths = []string{"lib", "plugins/git"}
+	require.Empty(t, plugin.checkoutSparse(hash), "cannot check out")
+
+	assert.FileExists(t, filepath.Join(plugin.Dir.Path, "oh-my-zsh.sh"))
+	assert.FileExists(t, filepath.Join(plugin.Dir.Path, "lib/git.zsh"))
+	assert.FileExists(t, filepath.Join(plugin.Dir.Path, "plugins/git/git.plugin.zsh"))
+	_, err = os.Stat(filepath.Join(plugin.Dir.Path, "plugins/github"))
+	assert.True(t, os.IsNotExist(err), "plugins that are not required must not be checked out")
+
+	_, err = plugin.CheckUpdate(true)
+	assert.Equal(t, UpToDate, err, "the checkout must be complete")
+
+	plugin.sparsePaths = append(plugin.sparsePaths, "plugins/github")
+	update, err := plugin.CheckUpdate(true)
+	require.Empty(t, err, "cannot check for updates")
+	require.NotNil(t, update, "missing directories must be checked out")
+	require.Empty(t, plugin.InstallUpdate(), "cannot check out missing directories")
+	assert.FileExists(t, filepath.Join(plugin.Dir.Path, "plugins/github/github.plugin.zsh"))
+
+	// directories that are no longer required are removed
+	plugin.sparsePaths = []string{"lib"}
+	require.Empty(t, plugin.checkoutSparse(hash), "cannot check out")
+	assert.FileExists(t, filepath.Join(plugin.Dir.Path, "lib/git.zsh"))
+	_, err = os.Stat(filepath.Join(plugin.Dir.Path, "plugins"))
+	assert.True(t, os.IsNotExist(err), "empty directories must be removed")
+}
+
+// Feature: Shallow clones
+//   Scenario: Clone the full history only when it may help
+//     Given a shallow clone of a plugin
+//     When the required revision is an unknown commit hash
+//     Then the full history is cloned
+//     When it is an unknown branch or an invalid version constraint
+//     Then the error is reported
+func TestShallowRevisionNotFound(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	repoPath := filepath.Join(tempDir, "github.com/username/repo")
+	head := makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+	shallowPath := filepath.Join(repoPath, git.GitDirName, "shallow")
+	require.Empty(t, ioutil.WriteFile(shallowPath, []byte(head.String()+"\n"), 0644))
+
+	plugin := NewGit("github.com/username/repo", "0123456789abcdef0123456789abcdef01234567", tempDir)
+	_, err = plugin.CheckUpdate(true)
+	require.Empty(t, err, "the full history must be cloned")
+	assert.True(t, plugin.reclone, "the full history must be cloned")
+
+	for _, revision := range []string{"no-such-branch", "^not-a-version"} {
+		plugin := NewGit("github.com/username/repo", revision, tempDir)
+		_, err = plugin.CheckUpdate(true)
+		assert.NotEmpty(t, err, "%s must not be found", revision)
+		assert.False(t, plugin.reclone, "%s must not be searched in the full history", revision)
+	}
+}
@@ -0,0 +1,128 @@
+package plugin
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// Feature: Interrupted installs and updates
+//   Scenario: Interrupt an install
+//     Given a plugin that is not installed
+//     When the install is interrupted
+//     Then the plugin stays not installed
+//     And no staging directories are left
+func TestInterruptedInstall(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	plugin := NewGit("github.com/username/repo", "master", tempDir)
+	plugin.network = &NetworkOptions{Context: ctx}
+
+	err = plugin.InstallUpdate()
+	assert.Equal(t, ErrInterrupted, errors.Cause(err))
+	installed, _ := plugin.IsInstalled()
+	assert.False(t, installed, "the plugin must not be installed")
+	files, err := ioutil.ReadDir(filepath.Join(tempDir, "github.com/username"))
+	require.Empty(t, err, "cannot list the parent directory")
+	assert.Empty(t, files, "the staging directory must be removed")
+}
+
+//   Scenario: Resume an interrupted update
+//     Given a plugin with files left by an interrupted checkout
+//     When the plugin is updated
+//     Then the files are replaced without the local changes policy
+func TestResumeInterruptedUpdate(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	first := makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+	second := makeTestCommit(t, repoPath, "repo.plugin.zsh", "second commit")
+	spec := "github.com/username/repo@" + first.String()
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: spec}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	pse := ps.Plugins[spec]
+
+	// the file is checked out, but the index is not written
+	err = ioutil.WriteFile(filepath.Join(repoPath, "repo.plugin.zsh"), []byte("first commit"), os.ModePerm)
+	require.Empty(t, err, "cannot write the leftover file")
+	pendingPath := filepath.Join(repoPath, git.GitDirName, pendingUpdateFileName)
+	pending := first.String() + "\n" + second.String() + "\n"
+	require.Empty(t, ioutil.WriteFile(pendingPath, []byte(pending), 0644))
+
+	pse.CheckPluginUpdate(true)
+	require.True(t, pse.HasUpdate(), "the interrupted update must be found")
+	assert.Empty(t, pse.LocalChanges(), "the leftovers are not local changes")
+	pse.Update()
+
+	revision, err := pse.Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.Equal(t, first.String(), revision, "the update must be resumed")
+	data, err := ioutil.ReadFile(filepath.Join(repoPath, "repo.plugin.zsh"))
+	require.Empty(t, err)
+	assert.Equal(t, "first commit", string(data))
+	_, err = os.Stat(pendingPath)
+	assert.True(t, os.IsNotExist(err), "the update must be finished")
+}
+
+//   Scenario: Keep local changes when resuming an update
+//     Given a plugin with an interrupted checkout and files changed by the user
+//     When the plugin is updated
+//     Then the changes of the user are reported
+//     And the update is skipped by the local changes policy
+func TestResumeInterruptedUpdateLocalChanges(t *testing.T) {
+	tempDir, _, pse, target := makeModifiedPlugin(t)
+	defer os.RemoveAll(tempDir)
+	repoPath := pse.Directory()
+	before, _ := pse.Revision()
+	pendingPath := filepath.Join(repoPath, git.GitDirName, pendingUpdateFileName)
+	require.Empty(t, ioutil.WriteFile(pendingPath, []byte(target+"\n"+before+"\n"), 0644))
+
+	pse.CheckPluginUpdate(true)
+	require.True(t, pse.HasUpdate(), "the interrupted update must be found")
+	expected := []LocalChange{
+		{Path: "cache.zwc", Status: "untracked"},
+		{Path: "repo.plugin.zsh", Status: "modified"},
+	}
+	assert.Equal(t, expected, pse.LocalChanges(), "the changes of the user must be reported")
+	pse.Update()
+
+	revision, err := pse.Revision()
+	require.Empty(t, err, "cannot get the revision")
+	assert.Equal(t, before, revision, "the update must be skipped")
+	data, err := ioutil.ReadFile(filepath.Join(repoPath, "repo.plugin.zsh"))
+	require.Empty(t, err)
+	assert.Equal(t, "local hack\n", string(data), "the local changes must be kept")
+}
+
+//   Scenario: Fail a checkout
+//     Given a plugin with an update
+//     When the checkout fails
+//     Then the checkout is not resumed by the next update
+func TestFailedCheckout(t *testing.T) {
+	tempDir, _, pse, _ := makeModifiedPlugin(t)
+	defer os.RemoveAll(tempDir)
+
+	pse.CheckPluginUpdate(true)
+	require.True(t, pse.HasUpdate(), "the update must be found")
+	p := pse.Plugin.(gitBased).gitPlugin()
+	missing := plumbing.NewHash("0123456789abcdef0123456789abcdef01234567")
+	p.update = &missing
+	assert.NotEmpty(t, p.checkout(), "the checkout must fail")
+
+	_, err := os.Stat(filepath.Join(pse.Directory(), git.GitDirName, pendingUpdateFileName))
+	assert.True(t, os.IsNotExist(err), "the pending update must be removed")
+}
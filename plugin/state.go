@@ -0,0 +1,301 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const stateFileName = "state.json"
+
+// The lock file guarding the changes of the records. The records are written
+// by commands holding the shared storage lock and by `zpm load` without the
+// storage lock, so they are changed under this lock instead.
+const stateLockFileName = "state.lock"
+
+// PluginRecord is what zpm remembers about a plugin installed from a Git
+// repository between commands.
+type PluginRecord struct {
+	Source string `json:"source"`
+	// The configured revision the state was found for.
+	RequiredRevision string `json:"required_revision"`
+	// The commit checked out when the state was found.
+	Revision string `json:"revision"`
+	// The time of the last install, update or rollback by zpm.
+	InstalledAt time.Time `json:"installed_at"`
+	// The time of the last successful check for updates with fetching.
+	LastCheck time.Time `json:"last_check"`
+	// The result of the last check, one of the states shown to users.
+	State string `json:"state"`
+	// The description of the update found by the last check.
+	Update string `json:"update,omitempty"`
+	// The reason of the error state.
+	Error string `json:"error,omitempty"`
+}
+
+// states keeps the records of plugins, so commands can use the results of
+// the previous ones instead of checking every repository.
+type states struct {
+	path  string
+	mutex sync.Mutex
+	// Records indexed by plugin specs.
+	Plugins map[string]PluginRecord `json:"plugins"`
+}
+
+func readStates(path string) (*states, error) {
+	s := &states{
+		path:    path,
+		Plugins: make(map[string]PluginRecord),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, errors.Wrap(err, "while reading the plugin states")
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return s, errors.Wrap(err, "while parsing the plugin states")
+	}
+	if s.Plugins == nil {
+		s.Plugins = make(map[string]PluginRecord)
+	}
+
+	return s, nil
+}
+
+// reload reads the records again, because other zpm processes may change them
+// while the storage is not locked.
+func (s *states) reload() error {
+	fresh, err := readStates(s.path)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Plugins = fresh.Plugins
+	return nil
+}
+
+// save must be called with the mutex locked. The file is replaced atomically,
+// because processes sharing the storage lock may read it at the same time.
+func (s *states) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "while serializing the plugin states")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), stateFileName+".")
+	if err != nil {
+		return errors.Wrap(err, "while writing the plugin states")
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		return errors.Wrap(err, "while writing the plugin states")
+	}
+	return nil
+}
+
+func (s *states) get(name string) (PluginRecord, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, ok := s.Plugins[name]
+	return record, ok
+}
+
+// change applies f to the records saved by all processes and saves them if f
+// returns true.
+func (s *states) change(f func(plugins map[string]PluginRecord) bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lockPath := filepath.Join(filepath.Dir(s.path), stateLockFileName)
+	lock, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "while locking the plugin states")
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return errors.Wrap(err, "while locking the plugin states")
+	}
+
+	// the records are merged with the ones written by other processes
+	fresh, err := readStates(s.path)
+	if err != nil {
+		// the broken file is replaced
+		log.Errorf("%s", err)
+	}
+	s.Plugins = fresh.Plugins
+	if !f(s.Plugins) {
+		return nil
+	}
+	return s.save()
+}
+
+// update changes the record of a plugin and saves the records if the record
+// is changed.
+func (s *states) update(name string, f func(record *PluginRecord)) error {
+	return s.change(func(plugins map[string]PluginRecord) bool {
+		previous, ok := plugins[name]
+		record := previous
+		f(&record)
+		if ok && previous == record {
+			return false
+		}
+		plugins[name] = record
+		return true
+	})
+}
+
+func (s *states) forget(name string) error {
+	return s.change(func(plugins map[string]PluginRecord) bool {
+		if _, ok := plugins[name]; !ok {
+			return false
+		}
+		delete(plugins, name)
+		return true
+	})
+}
+
+// recordState saves the current state of a plugin installed from a Git
+// repository. `checked` is set after a check with fetching and `installed`
+// after the plugin was installed, updated or rolled back.
+func (pse *pluginStorageEntry) recordState(checked bool, installed bool) {
+	now := time.Now()
+	pse.saveRecord(func(record *PluginRecord, info PluginInfo, update string) {
+		record.Update = update
+		record.Error = info.Error
+		if checked {
+			record.LastCheck = now
+		}
+		if installed {
+			record.InstalledAt = now
+		}
+	})
+}
+
+// recordOfflineState saves the state of a plugin checked without fetching. The
+// update and the error found by the last check with fetching are kept unless
+// new ones are found.
+func (pse *pluginStorageEntry) recordOfflineState() {
+	pse.saveRecord(func(record *PluginRecord, info PluginInfo, update string) {
+		if update != "" {
+			record.Update = update
+		}
+		if info.Error != "" {
+			record.Error = info.Error
+		}
+	})
+}
+
+func (pse *pluginStorageEntry) saveRecord(f func(record *PluginRecord, info PluginInfo, update string)) {
+	if pse.Directory() == "" || pse.state == pluginConfigLoaded {
+		return
+	}
+	// an interrupted command tells nothing about the plugin
+	if pse.state == pluginCheckError && errors.Cause(pse.errorState) == ErrInterrupted {
+		return
+	}
+	info := pse.info()
+	update := ""
+	if pse.state == pluginNeedUpdate && pse.updateState != nil {
+		update = *pse.updateState
+	}
+
+	err := pse.states.update(pse.Name, func(record *PluginRecord) {
+		record.Source = info.Source
+		record.RequiredRevision = info.RequiredRevision
+		record.Revision = info.InstalledRevision
+		record.State = info.State
+		f(record, info, update)
+	})
+	if err != nil {
+		log.Errorf("%s", err)
+	}
+}
+
+// Record returns what zpm remembers about a plugin installed from a Git
+// repository.
+func (pse *pluginStorageEntry) Record() (PluginRecord, bool) {
+	if pse.states == nil {
+		return PluginRecord{}, false
+	}
+	return pse.states.get(pse.Name)
+}
+
+// Forget deletes the record of a plugin removed from the configuration.
+func (pse *pluginStorageEntry) Forget() {
+	if err := pse.states.forget(pse.Name); err != nil {
+		log.Errorf("%s", err)
+	}
+}
+
+// restoreState sets the state recorded by the previous commands without
+// opening the repository. Plugins without records, with changed configurations
+// or with missing directories are checked offline.
+func (pse *pluginStorageEntry) restoreState() {
+	record, ok := pse.Record()
+	if !ok || pse.Directory() == "" {
+		pse.CheckPluginUpdate(true)
+		return
+	}
+	p := pse.Plugin.(gitBased).gitPlugin()
+	if p.Source() != record.Source || p.requiredRevision != record.RequiredRevision {
+		pse.CheckPluginUpdate(true)
+		return
+	}
+	if _, err := os.Stat(pse.Directory()); err != nil {
+		pse.CheckPluginUpdate(true)
+		return
+	}
+
+	switch record.State {
+	case StateInstalled:
+		pse.state = pluginInstalled
+	case StateNeedsUpdate:
+		update := record.Update
+		pse.state = pluginNeedUpdate
+		pse.updateState = &update
+	case StateError:
+		pse.state = pluginCheckError
+		pse.errorState = errors.New(record.Error)
+	default:
+		pse.CheckPluginUpdate(true)
+	}
+}
+
+// RecordedRevision returns the installed revision recorded for a plugin, so
+// the repository is not opened. The revision is read from the repository if
+// it is not recorded.
+func (pse *pluginStorageEntry) RecordedRevision() (string, error) {
+	if record, ok := pse.Record(); ok && record.Revision != "" {
+		return record.Revision, nil
+	}
+	return pse.Revision()
+}
+
+// RestoreStates sets the states of plugins recorded by the previous commands,
+// so the repositories are not opened. Changes made to the repositories outside
+// of zpm are found by the next check. Plugins without valid records are
+// checked offline. The restored updates are only reported: `CheckPluginUpdate`
+// must be called before they are installed.
+func (ps *PluginStorage) RestoreStates() {
+	for _, pse := range ps.Plugins {
+		pse.restoreState()
+	}
+}
@@ -0,0 +1,145 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Feature: Plugin states
+//   Scenario: Restore the recorded states
+//     Given a plugin with an update found by a check
+//     When the next command restores the states
+//     Then the update is known without checking the repository
+//     And the repository is checked only when the record is missing
+func TestRestoreStates(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	first := makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+	second := makeTestCommit(t, repoPath, "repo.plugin.zsh", "second commit")
+	spec := "github.com/username/repo@" + first.String()
+	configs := []Config{{Spec: spec}, {Spec: "dir://local"}}
+
+	ps, err := MakePluginStorage(tempDir, configs)
+	require.Empty(t, err, "cannot create the plugin storage")
+	ps.CheckPluginUpdates(true)
+	require.True(t, ps.Plugins[spec].HasUpdate(), "the update must be found")
+	record, ok := ps.Plugins[spec].Record()
+	require.True(t, ok, "the state must be recorded")
+	assert.Equal(t, StateNeedsUpdate, record.State)
+	assert.Equal(t, second.String(), record.Revision)
+	assert.True(t, record.LastCheck.IsZero(), "offline checks are not recorded as checks")
+
+	ps, err = MakePluginStorage(tempDir, configs)
+	require.Empty(t, err, "cannot create the plugin storage")
+	ps.RestoreStates()
+	assert.True(t, ps.Plugins[spec].HasUpdate(), "the update must be restored")
+	assert.True(t, ps.HasUpdates())
+
+	third := makeTestCommit(t, repoPath, "repo.plugin.zsh", "third commit")
+	ps, err = MakePluginStorage(tempDir, configs)
+	require.Empty(t, err, "cannot create the plugin storage")
+	ps.RestoreStates()
+	revision, err := ps.Plugins[spec].RecordedRevision()
+	require.Empty(t, err, "cannot get the recorded revision")
+	assert.Equal(t, second.String(), revision, "the record must be trusted")
+
+	ps.Plugins[spec].Forget()
+	ps, err = MakePluginStorage(tempDir, configs)
+	require.Empty(t, err, "cannot create the plugin storage")
+	ps.RestoreStates()
+	record, _ = ps.Plugins[spec].Record()
+	assert.Equal(t, third.String(), record.Revision, "the repository must be checked without a record")
+}
+
+//   Scenario: Record installs
+//     Given a plugin with an update
+//     When the update is installed
+//     Then the install time and the new revision are recorded
+func TestRecordUpdate(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	first := makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+	makeTestCommit(t, repoPath, "repo.plugin.zsh", "second commit")
+	spec := "github.com/username/repo@" + first.String()
+
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: spec}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	pse := ps.Plugins[spec]
+	pse.CheckPluginUpdate(true)
+	pse.Update()
+
+	record, ok := pse.Record()
+	require.True(t, ok, "the state must be recorded")
+	assert.Equal(t, StateInstalled, record.State)
+	assert.Equal(t, first.String(), record.Revision)
+	assert.Empty(t, record.Update)
+	assert.False(t, record.InstalledAt.IsZero(), "the install time must be recorded")
+	info := pse.info()
+	require.NotNil(t, info.InstalledAt)
+	assert.Equal(t, record.InstalledAt, *info.InstalledAt)
+}
+
+//   Scenario: Record states in parallel
+//     Given two processes that read the records before each other's changes
+//     When both processes record plugin states
+//     Then the records of both are saved
+func TestRecordStatesMerge(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, stateFileName)
+
+	first, err := readStates(path)
+	require.Empty(t, err, "cannot read the states")
+	second, err := readStates(path)
+	require.Empty(t, err, "cannot read the states")
+
+	require.Empty(t, first.update("first", func(record *PluginRecord) { record.State = StateInstalled }))
+	require.Empty(t, second.update("second", func(record *PluginRecord) { record.State = StateNeedsUpdate }))
+
+	saved, err := readStates(path)
+	require.Empty(t, err, "cannot read the states")
+	assert.Equal(t, StateInstalled, saved.Plugins["first"].State, "the first record must be kept")
+	assert.Equal(t, StateNeedsUpdate, saved.Plugins["second"].State, "the second record must be saved")
+}
+
+//   Scenario: Keep the error of a check
+//     Given a plugin that could not be checked with fetching
+//     When it is checked without fetching
+//     Then the recorded error is kept
+func TestRecordOfflineCheck(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	makeTestCommit(t, repoPath, "repo.plugin.zsh", "first commit")
+	spec := "github.com/username/repo"
+
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: spec}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	pse := ps.Plugins[spec]
+	pse.state = pluginCheckError
+	pse.errorState = errors.New("cannot fetch")
+	pse.recordState(false, false)
+
+	pse.CheckPluginUpdate(true)
+	assert.Empty(t, pse.info().Error, "the offline check must succeed")
+	record, ok := pse.Record()
+	require.True(t, ok, "the state must be recorded")
+	assert.Equal(t, StateInstalled, record.State)
+	assert.Equal(t, "cannot fetch", record.Error, "the error must be kept")
+	assert.Equal(t, "cannot fetch", pse.info().LastError, "the error must be shown")
+}
@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"fmt"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sync"
@@ -12,6 +13,9 @@ import (
 
 var ErrUnknownPluginType = errors.New("cannot parse the spec for an unknown plugin type")
 
+// The number of plugins checked or installed at the same time by default.
+const defaultJobs = 8
+
 type pluginState int32
 
 const (
@@ -25,77 +29,146 @@ const (
 type pluginStorageEntry struct {
 	Name        string
 	Plugin      Plugin
+	Config      Config
 	state       pluginState
 	errorState  error
 	updateState *string
+	history     *history
+	states      *states
+	storage     *PluginStorage
+	kind        string
+	// set by `AllowUpdate` to update the plugin even if it was rolled back
+	unfreeze bool
+	// set by `ApplyLock`, the locked revision is checked out even if the
+	// plugin was rolled back
+	pinned bool
+	// the named parts of the spec, like the user name and the repository
+	specFields map[string]string
 }
 
-type pluginStorage struct {
+// PluginStorage keeps all plugins listed in the configuration file.
+type PluginStorage struct {
 	Plugins map[string]*pluginStorageEntry
 	// the order in which plugins are loaded is important, so we must preserve it
 	LoadOrder []string
+	// What happens to the local changes of plugins when they are updated.
+	LocalChangesPolicy LocalChangesPolicy
+	// The maximum number of plugins checked or installed at the same time.
+	Jobs int
+	// Timeouts and retries of fetches and clones.
+	Network NetworkOptions
+	// Credentials of the Git servers plugins are installed from.
+	Auth AuthOptions
+	// The file with the armored OpenPGP keyring used to verify plugins with
+	// the `verify` setting.
+	Keyring string
+	// Receives the progress of checks, installations and updates if set.
+	Progress Progress
+	root     string
+	// The records shared by all plugins.
+	history *history
+	states  *states
 }
 
 type loaderSpec struct {
 	loader func(string, map[string]string) (*Plugin, error)
 	regex  *regexp.Regexp
+	// the plugin type shown to users
+	kind string
 }
 
-func (ls loaderSpec) matchAndLoad(root, spec string) (*Plugin, error) {
+// fields returns the named parts of the spec or nil if the spec does not match.
+func (ls loaderSpec) fields(spec string) map[string]string {
 	matches := ls.regex.FindStringSubmatch(spec)
 	if len(matches) == 0 {
-		return nil, nil
+		return nil
 	}
 	matchesDict := make(map[string]string)
 	for idx, match := range matches {
 		matchesDict[ls.regex.SubexpNames()[idx]] = match
 	}
+	return matchesDict
+}
+
+func (ls loaderSpec) matchAndLoad(root, spec string) (*Plugin, error) {
+	matchesDict := ls.fields(spec)
+	if matchesDict == nil {
+		return nil, nil
+	}
 	return ls.loader(root, matchesDict)
 }
 
 func MakePluginStorage(
 	root string,
-	pluginSpecs []string,
-) (ps *pluginStorage, err error) {
-	ps = &pluginStorage{
-		Plugins: make(map[string]*pluginStorageEntry),
+	pluginConfigs []Config,
+) (ps *PluginStorage, err error) {
+	ps = &PluginStorage{
+		Plugins:            make(map[string]*pluginStorageEntry),
+		LocalChangesPolicy: LocalChangesSkip,
+		Jobs:               defaultJobs,
+		root:               root,
 	}
 
+	history, err := readHistory(filepath.Join(root, historyFileName))
+	if err != nil {
+		// the history is not required to load plugins, so it is just reset
+		log.Errorf("%s", err)
+	}
+	states, err := readStates(filepath.Join(root, stateFileName))
+	if err != nil {
+		// the states are found again by checking the plugins
+		log.Errorf("%s", err)
+	}
+	ps.history = history
+	ps.states = states
+
 	root = filepath.Join(root, "Plugins")
 
 	omzPlugin, _ := MakeOhMyZsh(root, map[string]string{})
 	omz := (*omzPlugin).(*OhMyZsh)
-	omzName := "oh-my-zsh"
+	omzConfig := Config{Spec: "oh-my-zsh"}
 	omzRequired := false
+	// directories of Oh My Zsh required by the configured plugins and themes
+	omzPaths := []string{"lib"}
+	// the spec of Oh My Zsh is parsed only when it is listed explicitly
+	omzFields := map[string]string{}
 
 	omzMakePlugin := func(root string, params map[string]string) (*Plugin, error) {
 		omzRequired = true
+		omzPaths = append(omzPaths, path.Join("plugins", params["name"]))
 		return omz.MakePlugin(root, params)
 	}
 	omzMakeTheme := func(root string, params map[string]string) (*Plugin, error) {
 		omzRequired = true
+		omzPaths = append(omzPaths, path.Join("themes", params["name"]))
 		return omz.MakeTheme(root, params)
 	}
 	omzMakeOhMyZsh := func(root string, params map[string]string) (*Plugin, error) {
 		omzRequired = true
+		omzFields = params
 		return MakeOhMyZsh(root, params)
 	}
 
 	loaders := []loaderSpec{
-		{MakeGitHub, regexp.MustCompile(`^github\.com/(?P<username>[a-z0-9\-]+)/(?P<repo>[a-z0-9\-]+)(@(?P<version>.+))?$`)},
-		{MakeDir, regexp.MustCompile(`^dir://(?P<directory>.*)$`)},
-		{omzMakePlugin, regexp.MustCompile(`^oh-my-zsh/plugin/(?P<name>[a-z0-9\-]+)$`)},
-		{omzMakeTheme, regexp.MustCompile(`^oh-my-zsh/theme/(?P<name>[a-z0-9\-]+)$`)},
-		{omzMakeOhMyZsh, regexp.MustCompile(`^oh-my-zsh(@(?P<version>.+))?$`)},
+		{MakeGitHub, regexp.MustCompile(`^github\.com/(?P<username>[a-z0-9\-]+)/(?P<repo>[a-z0-9\-]+)(@(?P<version>.+))?$`), "github"},
+		{MakeDir, regexp.MustCompile(`^dir://(?P<directory>.*)$`), "dir"},
+		{omzMakePlugin, regexp.MustCompile(`^oh-my-zsh/plugin/(?P<name>[a-z0-9\-]+)$`), "oh-my-zsh-plugin"},
+		{omzMakeTheme, regexp.MustCompile(`^oh-my-zsh/theme/(?P<name>[a-z0-9\-]+)$`), "oh-my-zsh-theme"},
+		{omzMakeOhMyZsh, regexp.MustCompile(`^oh-my-zsh(@(?P<version>.+))?$`), "oh-my-zsh"},
 	}
 
-	for _, pluginSpec := range pluginSpecs {
+	for _, pluginConfig := range pluginConfigs {
+		pluginSpec := pluginConfig.Spec
 		pse := &pluginStorageEntry{
 			Name:        pluginSpec,
 			Plugin:      nil,
+			Config:      pluginConfig,
 			state:       pluginConfigLoaded,
 			errorState:  nil,
 			updateState: nil,
+			history:     history,
+			states:      states,
+			storage:     ps,
 		}
 
 		for _, loader := range loaders {
@@ -108,6 +181,8 @@ func MakePluginStorage(
 			}
 
 			pse.Plugin = *plugin
+			pse.kind = loader.kind
+			pse.specFields = loader.fields(pluginSpec)
 			ps.Plugins[pse.Name] = pse
 			break
 		}
@@ -116,38 +191,92 @@ func MakePluginStorage(
 			return nil, ErrUnknownPluginType
 		}
 
+		if g, ok := pse.Plugin.(gitBased); ok {
+			g.gitPlugin().depth = pluginConfig.Depth
+			g.gitPlugin().network = &ps.Network
+			g.gitPlugin().auth = &ps.Auth
+			g.gitPlugin().progress = pse.reportPhase
+			if pluginConfig.Verify {
+				g.gitPlugin().keyring = &ps.Keyring
+			}
+		}
+		if _, isOmz := pse.Plugin.(*OhMyZsh); pluginConfig.Sparse && !isOmz {
+			log.Warnf("%s: sparse checkouts are only supported for oh-my-zsh", pluginSpec)
+		}
+
 		_, isOmz := pse.Plugin.(*OhMyZsh)
 
 		// Oh My Zsh is required to be inserted in the beginning of the plugin load sequence
 		if isOmz {
-			omzName = pluginSpec
+			omzConfig = pluginConfig
 		} else {
 			ps.LoadOrder = append(ps.LoadOrder, pluginSpec)
 		}
 	}
 
 	if omzRequired {
-		ps.Plugins[omzName] = &pluginStorageEntry{
-			Name:        "oh-my-zsh",
+		omz.git.depth = omzConfig.Depth
+		omz.git.network = &ps.Network
+		omz.git.auth = &ps.Auth
+		if omzConfig.Verify {
+			omz.git.keyring = &ps.Keyring
+		}
+		if omzConfig.Sparse {
+			omz.git.sparsePaths = omzPaths
+		}
+		omzEntry := &pluginStorageEntry{
+			Name:        omzConfig.Spec,
 			Plugin:      *omzPlugin,
+			Config:      omzConfig,
 			state:       pluginConfigLoaded,
 			errorState:  nil,
 			updateState: nil,
+			history:     history,
+			states:      states,
+			storage:     ps,
+			kind:        "oh-my-zsh",
+			specFields:  omzFields,
 		}
-		ps.LoadOrder = append([]string{omzName}, ps.LoadOrder...)
+		omz.git.progress = omzEntry.reportPhase
+		ps.Plugins[omzConfig.Spec] = omzEntry
+		ps.LoadOrder = append([]string{omzConfig.Spec}, ps.LoadOrder...)
 	}
 
 	return ps, nil
 }
 
 func (pse *pluginStorageEntry) updateInternal() bool {
+	if pse.storage != nil && pse.storage.Network.interrupted() {
+		// the plugin keeps its state
+		pse.reportFinish("interrupted")
+		return false
+	}
+
+	// the replaced revision is recorded to allow rollbacks
+	previousRevision, revisionErr := pse.Revision()
+
+	if !pse.applyLocalChangesPolicy() {
+		pse.reportFinish("skipped because of local changes")
+		return false
+	}
+
 	if err := pse.Plugin.InstallUpdate(); err != nil {
 		log.Errorf("while installing %s: %s", pse.Name, err)
+		pse.reportFinish("failed")
 		pse.state = pluginCheckError
-		errorState := errors.Wrap(err, "while installing %s")
+		errorState := errors.Wrapf(err, "while installing %s", pse.Name)
 		pse.errorState = errorState
+		pse.recordState(false, false)
 		return false
 	}
+
+	if revisionErr == nil {
+		if err := pse.history.record(pse.Name, previousRevision); err != nil {
+			log.Errorf("%s", err)
+			log.Errorf("note that the update of %s cannot be rolled back", pse.Name)
+		}
+	}
+
 	return true
 }
 
@@ -158,8 +287,11 @@ func (pse *pluginStorageEntry) Update() {
 
 	if pse.updateInternal() {
 		log.Infof("installed update for %s", pse.Name)
+		pse.reportFinish("updated")
 		pse.state = pluginInstalled
 		pse.updateState = nil
+		pse.recordState(false, true)
+		pse.finishUnfreeze()
 	}
 }
 
@@ -171,7 +303,9 @@ func (pse *pluginStorageEntry) install() {
 
 	if pse.updateInternal() {
 		log.Infof("installed %s", pse.Name)
+		pse.reportFinish("installed")
 		pse.state = pluginInstalled
+		pse.recordState(false, true)
 	}
 }
 
@@ -195,6 +329,7 @@ func (pse *pluginStorageEntry) CheckPluginUpdate(offline bool) {
 
 	if IsNotInstalled(err) {
 		log.Infof("not installed: %s", pse.Name)
+		pse.reportFinish("not installed")
 		pse.state = pluginNeedInstall
 	} else if err == NotInstallable {
 		log.Debugf("plugin %s is not installable", pse.Name)
@@ -203,66 +338,117 @@ func (pse *pluginStorageEntry) CheckPluginUpdate(offline bool) {
 		pse.state = pluginInstalled
 	} else if IsUpToDate(err) {
 		log.Debugf("up to date: %s", pse.Name)
+		pse.reportFinish("up to date")
+		pse.state = pluginInstalled
+		pse.finishUnfreeze()
+	} else if IsNotVerified(err) {
+		log.Errorf("%s: %s, keeping the installed revision", pse.Name, err)
+		pse.reportFinish("not verified")
 		pse.state = pluginInstalled
 	} else if err != nil {
 		log.Errorf("while checking for %s: %s", pse.Name, err)
+		pse.reportFinish("failed")
 		pse.state = pluginCheckError
 		errorState := errors.Wrap(err, fmt.Sprintf("while checking for %s", pse.Name))
 		pse.errorState = errorState
+	} else if update != nil && pse.history.isFrozen(pse.Name) && !pse.unfreeze && !pse.pinned {
+		log.Infof("%s is frozen after a rollback, run `zpm update --plugin %s` to update it", pse.Name, pse.Name)
+		pse.reportFinish("frozen")
+		pse.state = pluginInstalled
 	} else if update != nil {
 		updateLine := fmt.Sprintf("update available for %s: %s", pse.Name, *update)
-		log.Infof(updateLine)
+		log.Info(updateLine)
+		pse.reportFinish("update available")
 		pse.state = pluginNeedUpdate
 		pse.updateState = &updateLine
 	}
+
+	if offline {
+		pse.recordOfflineState()
+		return
+	}
+	pse.recordState(pse.state == pluginInstalled || pse.state == pluginNeedUpdate, false)
 }
 
-// checkPluginUpdates checks for both updates and plugins that are not installed
-func (ps *pluginStorage) CheckPluginUpdates(offline bool) {
+// Revision returns the installed revision of a plugin. Plugins that are not
+// installed from a Git repository are not versioned and return
+// `ErrNotUpgradable`.
+func (pse *pluginStorageEntry) Revision() (string, error) {
+	g, ok := pse.Plugin.(gitBased)
+	if !ok {
+		return "", ErrNotUpgradable
+	}
+	return g.gitPlugin().Revision()
+}
+
+// HasUpdate tells whether an update was found by `CheckPluginUpdate`.
+func (pse *pluginStorageEntry) HasUpdate() bool {
+	return pse.state == pluginNeedUpdate
+}
+
+// Changelog returns the changes an update of the plugin will bring. Must be
+// called after `CheckPluginUpdate` found an update.
+func (pse *pluginStorageEntry) Changelog() (*Changelog, error) {
+	g, ok := pse.Plugin.(gitBased)
+	if !ok || !pse.HasUpdate() {
+		return nil, errors.New("no update available")
+	}
+	return g.gitPlugin().Changelog()
+}
+
+// forEach runs the function for every plugin using at most `Jobs` goroutines.
+func (ps *PluginStorage) forEach(f func(pse *pluginStorageEntry)) {
+	jobs := ps.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	queue := make(chan *pluginStorageEntry)
 	waitGroup := sync.WaitGroup{}
-	waitGroup.Add(len(ps.Plugins))
-	for i := range ps.Plugins {
-		go func(i string) {
-			ps.Plugins[i].CheckPluginUpdate(offline)
+	waitGroup.Add(jobs)
+	for i := 0; i < jobs; i++ {
+		go func() {
+			for pse := range queue {
+				f(pse)
+			}
 			waitGroup.Done()
-		}(i)
+		}()
+	}
+	for _, pse := range ps.Plugins {
+		queue <- pse
 	}
+	close(queue)
 	waitGroup.Wait()
 }
 
+// checkPluginUpdates checks for both updates and plugins that are not installed
+func (ps *PluginStorage) CheckPluginUpdates(offline bool) {
+	ps.forEach(func(pse *pluginStorageEntry) {
+		pse.CheckPluginUpdate(offline)
+	})
+}
+
 // checkPluginInstalls checks for plugins that are not installed
-func (ps *pluginStorage) CheckPluginInstalls() {
+func (ps *PluginStorage) CheckPluginInstalls() {
 	for i := range ps.Plugins {
 		ps.Plugins[i].checkPluginInstall()
 	}
 }
 
-func (ps *pluginStorage) UpdateAll() {
-	waitGroup := sync.WaitGroup{}
-	waitGroup.Add(len(ps.Plugins))
-	for i := range ps.Plugins {
-		go func(i string) {
-			ps.Plugins[i].Update()
-			waitGroup.Done()
-		}(i)
-	}
-	waitGroup.Wait()
+func (ps *PluginStorage) UpdateAll() {
+	ps.forEach(func(pse *pluginStorageEntry) {
+		pse.Update()
+	})
 }
 
 // installAll installs all plugins detected by checkPluginInstalls or checkPluginUpdates
-func (ps *pluginStorage) InstallAll() {
-	waitGroup := sync.WaitGroup{}
-	waitGroup.Add(len(ps.Plugins))
-	for i := range ps.Plugins {
-		go func(i string) {
-			ps.Plugins[i].install()
-			waitGroup.Done()
-		}(i)
-	}
-	waitGroup.Wait()
+func (ps *PluginStorage) InstallAll() {
+	ps.forEach(func(pse *pluginStorageEntry) {
+		pse.install()
+	})
 }
 
-func (ps pluginStorage) HasUpdates() bool {
+func (ps PluginStorage) HasUpdates() bool {
 	for _, pse := range ps.Plugins {
 		if pse.state == pluginNeedUpdate {
 			return true
@@ -272,7 +458,7 @@ func (ps pluginStorage) HasUpdates() bool {
 	return false
 }
 
-func (ps pluginStorage) HasInstalls() bool {
+func (ps PluginStorage) HasInstalls() bool {
 	for _, pse := range ps.Plugins {
 		if pse.state == pluginNeedInstall {
 			return true
@@ -281,3 +467,14 @@ func (ps pluginStorage) HasInstalls() bool {
 
 	return false
 }
+
+// Directory returns the directory a plugin installed from a Git repository is
+// cloned into. Local plugins are not managed by zpm, so an empty string is
+// returned for them.
+func (pse *pluginStorageEntry) Directory() string {
+	g, ok := pse.Plugin.(gitBased)
+	if !ok {
+		return ""
+	}
+	return g.gitPlugin().Dir.Path
+}
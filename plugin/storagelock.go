@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// The lock file of the plugin storage in the storage root.
+const storageLockFileName = ".lock"
+
+// How often a locked storage is checked while waiting.
+var storageLockPollPeriod = 100 * time.Millisecond
+
+// StorageLockedError is returned when the plugin storage stays locked by
+// another zpm process longer than the wait timeout.
+type StorageLockedError struct {
+	// Zero if the process is not known.
+	PID int
+}
+
+func (e *StorageLockedError) Error() string {
+	if e.PID == 0 {
+		return "the plugin storage is locked by another zpm process"
+	}
+	return fmt.Sprintf("the plugin storage is locked by zpm process %d", e.PID)
+}
+
+// StorageLock prevents zpm processes from changing the plugin storage at the
+// same time. Any number of processes can hold a shared lock to read the
+// storage, while changing it requires the exclusive lock.
+type StorageLock struct {
+	file *os.File
+}
+
+// LockStorage locks the plugin storage, waiting for other processes at most
+// for the timeout. The PID of the last process that locked the storage is
+// written into the lock file to be reported to the waiting processes. The
+// update history and the plugin records are read again once the lock is held.
+func (ps *PluginStorage) LockStorage(exclusive bool, timeout time.Duration) (*StorageLock, error) {
+	path := filepath.Join(ps.root, storageLockFileName)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "while opening the lock of the plugin storage")
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	deadline := time.Now().Add(timeout)
+	for waiting := false; ; waiting = true {
+		err = syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK {
+			file.Close()
+			return nil, errors.Wrap(err, "while locking the plugin storage")
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, &StorageLockedError{PID: lockHolder(path)}
+		}
+		if !waiting {
+			log.Infof("%s, waiting", &StorageLockedError{PID: lockHolder(path)})
+		}
+		time.Sleep(storageLockPollPeriod)
+	}
+
+	// shared holders overwrite each other, so the PID is the latest one
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+
+	// the records read with the storage may be changed by the process that
+	// held the lock
+	if err := ps.history.reload(); err != nil {
+		log.Errorf("%s", err)
+	}
+	if err := ps.states.reload(); err != nil {
+		log.Errorf("%s", err)
+	}
+	return &StorageLock{file: file}, nil
+}
+
+// lockHolder returns the PID written into the lock file or zero.
+func lockHolder(path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
+// Unlock releases the lock. The lock file is kept, because other processes
+// may wait for it.
+func (l *StorageLock) Unlock() error {
+	if err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN); err != nil {
+		l.file.Close()
+		return errors.Wrap(err, "while unlocking the plugin storage")
+	}
+	return l.file.Close()
+}
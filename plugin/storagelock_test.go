@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Feature: Locking the plugin storage
+//   Scenario: Share and wait for the lock
+//     Given two processes reading the plugin storage
+//     When a third process changes the plugin storage
+//     Then it waits for the readers
+//     And the PID of the holder is reported on timeout
+func TestLockStorage(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+	ps, err := MakePluginStorage(tempDir, []Config{})
+	require.Empty(t, err, "cannot create the plugin storage")
+
+	first, err := ps.LockStorage(false, 0)
+	require.Empty(t, err, "cannot lock the storage")
+	second, err := ps.LockStorage(false, 0)
+	require.Empty(t, err, "the lock must be shared")
+
+	_, err = ps.LockStorage(true, 200*time.Millisecond)
+	require.IsType(t, &StorageLockedError{}, err, "the exclusive lock must not be taken")
+	assert.Equal(t, os.Getpid(), err.(*StorageLockedError).PID, "the holder must be reported")
+
+	require.Empty(t, first.Unlock())
+	require.Empty(t, second.Unlock())
+	exclusive, err := ps.LockStorage(true, 0)
+	require.Empty(t, err, "the exclusive lock must be taken after the readers finish")
+	_, err = ps.LockStorage(false, 0)
+	assert.IsType(t, &StorageLockedError{}, err, "readers must wait for the exclusive lock")
+	require.Empty(t, exclusive.Unlock())
+}
+
+//   Scenario: Read the records of the previous holder
+//     Given a process waiting for the lock
+//     When the holder records an update and releases the lock
+//     Then the waiting process reads the recorded update
+//     And does not overwrite it
+func TestLockStorageReloadsRecords(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+	holder, err := MakePluginStorage(tempDir, []Config{})
+	require.Empty(t, err, "cannot create the plugin storage")
+	waiting, err := MakePluginStorage(tempDir, []Config{})
+	require.Empty(t, err, "cannot create the plugin storage")
+
+	lock, err := holder.LockStorage(true, 0)
+	require.Empty(t, err, "cannot lock the storage")
+	require.Empty(t, holder.history.record("github.com/username/repo", "first"))
+	require.Empty(t, lock.Unlock())
+
+	lock, err = waiting.LockStorage(true, 0)
+	require.Empty(t, err, "cannot lock the storage")
+	defer lock.Unlock()
+	require.Len(t, waiting.history.entries("github.com/username/repo"), 1, "the update must be read")
+	require.Empty(t, waiting.history.setFrozen("github.com/username/other", true))
+
+	reread, err := readHistory(holder.history.path)
+	require.Empty(t, err, "cannot read the history")
+	assert.Len(t, reread.entries("github.com/username/repo"), 1, "the update must be kept")
+}
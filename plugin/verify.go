@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// NotVerifiedError is returned by `Plugin.CheckUpdate` and
+// `Plugin.InstallUpdate` when the required revision of a plugin with the
+// `verify` setting is not signed by a trusted key.
+type NotVerifiedError struct {
+	// The tag or the commit that was checked.
+	Revision string
+	Reason   string
+}
+
+func (e *NotVerifiedError) Error() string {
+	return fmt.Sprintf("%s is not signed by a trusted key: %s", e.Revision, e.Reason)
+}
+
+// Check if the required revision of a plugin is not signed by a trusted key
+// with the error value of `Plugin.CheckUpdate`.
+func IsNotVerified(err error) bool {
+	_, ok := errors.Cause(err).(*NotVerifiedError)
+	return ok
+}
+
+// verifyRevision checks that the commit the plugin is moved to is signed by a
+// key from the keyring. When the revision was resolved from a signed tag, the
+// signature of the tag is checked instead.
+func (p *Git) verifyRevision(hash plumbing.Hash) error {
+	if p.keyring == nil {
+		return nil
+	}
+	if *p.keyring == "" {
+		return errors.New("the keyring for signature verification is not configured")
+	}
+	keyring, err := ioutil.ReadFile(*p.keyring)
+	if err != nil {
+		return errors.Wrap(err, "while reading the keyring")
+	}
+
+	if tag := p.signedTag(hash); tag != nil {
+		entity, err := tag.Verify(string(keyring))
+		if err != nil {
+			return &NotVerifiedError{Revision: "tag " + tag.Name, Reason: err.Error()}
+		}
+		log.Debugf("tag %s of %s is signed by %s", tag.Name, p.URL, entityName(entity))
+		return nil
+	}
+
+	revision := "commit " + hash.String()[:7]
+	commit, err := p.repository.CommitObject(hash)
+	if err != nil {
+		return errors.Wrap(err, "cannot read the target commit")
+	}
+	if commit.PGPSignature == "" {
+		return &NotVerifiedError{Revision: revision, Reason: "no signature"}
+	}
+	entity, err := commit.Verify(string(keyring))
+	if err != nil {
+		return &NotVerifiedError{Revision: revision, Reason: err.Error()}
+	}
+	log.Debugf("%s of %s is signed by %s", revision, p.URL, entityName(entity))
+	return nil
+}
+
+// signedTag returns the signed annotated tag the required revision was resolved
+// from, if any.
+func (p *Git) signedTag(hash plumbing.Hash) *object.Tag {
+	name := p.resolvedTag
+	if name == "" {
+		name = p.requiredRevision
+	}
+	ref, err := p.repository.Tag(name)
+	if err != nil {
+		return nil
+	}
+	// lightweight tags have no signatures
+	tag, err := p.repository.TagObject(ref.Hash())
+	if err != nil || tag.PGPSignature == "" {
+		return nil
+	}
+	commit, err := tag.Commit()
+	if err != nil || commit.Hash != hash {
+		return nil
+	}
+	return tag
+}
+
+// entityName returns the name of the key owner for logs.
+func entityName(entity *openpgp.Entity) string {
+	for name := range entity.Identities {
+		return name
+	}
+	return entity.PrimaryKey.KeyIdString()
+}
@@ -0,0 +1,112 @@
+package plugin
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// makeSignedTestCommit creates a commit signed with the key in the repository
+// located at path.
+func makeSignedTestCommit(t *testing.T, path string, message string, key *openpgp.Entity) plumbing.Hash {
+	repository, err := git.PlainOpen(path)
+	require.Empty(t, err, "cannot open the test repository")
+
+	err = ioutil.WriteFile(filepath.Join(path, "repo.plugin.zsh"), []byte(message), os.ModePerm)
+	require.Empty(t, err, "cannot write a test file")
+
+	worktree, err := repository.Worktree()
+	require.Empty(t, err, "cannot open the worktree")
+	_, err = worktree.Add("repo.plugin.zsh")
+	require.Empty(t, err, "cannot add a test file")
+
+	hash, err := worktree.Commit(message, &git.CommitOptions{
+		Author:  &object.Signature{Name: "zpm", Email: "zpm@example.com", When: time.Now()},
+		SignKey: key,
+	})
+	require.Empty(t, err, "cannot commit")
+	return hash
+}
+
+// Feature: Signature verification
+//   Scenario: Verify required revisions
+//     Given a plugin with the `verify` setting
+//     And commits and tags signed with trusted, untrusted or no keys
+//     When the plugin is checked for updates
+//     Then only revisions signed with a trusted key are installed
+//     And the plugin stays at the installed revision otherwise
+func TestVerifyRevision(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	require.Empty(t, err, "cannot create temp dir")
+	defer os.RemoveAll(tempDir)
+
+	trusted, err := openpgp.NewEntity("zpm", "", "zpm@example.com", nil)
+	require.Empty(t, err, "cannot create a key")
+	untrusted, err := openpgp.NewEntity("someone", "", "someone@example.com", nil)
+	require.Empty(t, err, "cannot create a key")
+
+	keyring := &bytes.Buffer{}
+	w, err := armor.Encode(keyring, openpgp.PublicKeyType, nil)
+	require.Empty(t, err)
+	require.Empty(t, trusted.Serialize(w))
+	require.Empty(t, w.Close())
+	keyringPath := filepath.Join(tempDir, "keyring.asc")
+	require.Empty(t, ioutil.WriteFile(keyringPath, keyring.Bytes(), 0644))
+
+	repoPath := filepath.Join(tempDir, "Plugins", "github.com/username/repo")
+	unsigned := makeTestCommit(t, repoPath, "repo.plugin.zsh", "unsigned")
+	signed := makeSignedTestCommit(t, repoPath, "signed", trusted)
+	signedUntrusted := makeSignedTestCommit(t, repoPath, "signed by an untrusted key", untrusted)
+	makeTestCommit(t, repoPath, "repo.plugin.zsh", "installed")
+
+	repository, err := git.PlainOpen(repoPath)
+	require.Empty(t, err, "cannot open the test repository")
+	_, err = repository.CreateTag("v1.0.0", unsigned, &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "zpm", Email: "zpm@example.com", When: time.Now()},
+		Message: "release",
+		SignKey: trusted,
+	})
+	require.Empty(t, err, "cannot create a tag")
+
+	cases := []struct {
+		revision string
+		verified bool
+	}{
+		{signed.String(), true},
+		{signedUntrusted.String(), false},
+		{unsigned.String(), false},
+		{"v1.0.0", true},
+	}
+	for _, c := range cases {
+		spec := "github.com/username/repo@" + c.revision
+		ps, err := MakePluginStorage(tempDir, []Config{{Spec: spec, Verify: true}})
+		require.Empty(t, err, "cannot create the plugin storage")
+		ps.Keyring = keyringPath
+		pse := ps.Plugins[spec]
+
+		_, err = pse.Plugin.CheckUpdate(true)
+		assert.Equal(t, !c.verified, IsNotVerified(err), "invalid verification of %s: %v", c.revision, err)
+
+		pse.CheckPluginUpdate(true)
+		assert.Equal(t, c.verified, pse.HasUpdate(), "invalid update state of %s", c.revision)
+	}
+
+	// the verification is opt-in
+	spec := "github.com/username/repo@" + unsigned.String()
+	ps, err := MakePluginStorage(tempDir, []Config{{Spec: spec}})
+	require.Empty(t, err, "cannot create the plugin storage")
+	pse := ps.Plugins[spec]
+	pse.CheckPluginUpdate(true)
+	assert.True(t, pse.HasUpdate(), "revisions of plugins without `verify` must not be verified")
+}
@@ -0,0 +1,117 @@
+// Package zsh generates zsh code for load scripts. Every value that comes from
+// the file system or from the configuration must be passed through this
+// package, so unusual paths (spaces, quotes, glob characters, etc) do not break
+// the generated scripts.
+package zsh
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Words consisting only of these characters are never expanded by zsh.
+const safeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+=@%/:.,"
+
+var errCannotUnquote = errors.New("not a quoted word")
+
+// Quote returns a representation of the value that is always treated as a
+// single word by zsh.
+func Quote(value string) string {
+	if value == "" {
+		return "''"
+	}
+	isSafe := true
+	for _, r := range value {
+		if !strings.ContainsRune(safeChars, r) {
+			isSafe = false
+			break
+		}
+	}
+	// a leading "=" triggers the equals expansion (`=ls` is the path to `ls`)
+	if isSafe && value[0] != '=' {
+		return value
+	}
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// Unquote reverses `Quote`. It fails on words that can possibly be expanded
+// by zsh.
+func Unquote(word string) (string, error) {
+	var value strings.Builder
+	for len(word) > 0 {
+		switch word[0] {
+		case '\'':
+			end := strings.IndexByte(word[1:], '\'')
+			if end < 0 {
+				return "", errCannotUnquote
+			}
+			value.WriteString(word[1 : end+1])
+			word = word[end+2:]
+		case '\\':
+			if len(word) < 2 {
+				return "", errCannotUnquote
+			}
+			value.WriteByte(word[1])
+			word = word[2:]
+		default:
+			if !strings.ContainsRune(safeChars, rune(word[0])) {
+				return "", errCannotUnquote
+			}
+			value.WriteByte(word[0])
+			word = word[1:]
+		}
+	}
+	return value.String(), nil
+}
+
+// Command returns a command line with every argument quoted.
+func Command(args ...string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, Quote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Source returns a line that sources the file.
+func Source(path string) string {
+	return Command("source", path)
+}
+
+// SourcedFile returns the path of the file sourced by the line generated by
+// `Source`.
+func SourcedFile(line string) (path string, ok bool) {
+	word := strings.TrimPrefix(line, "source ")
+	if word == line {
+		return "", false
+	}
+	path, err := Unquote(word)
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// Assign returns a line that assigns the value to the variable. The name of
+// the variable must be validated by the caller.
+func Assign(name string, value string) string {
+	return name + "=" + Quote(value)
+}
+
+// Export returns a line that assigns the value to the variable and exports
+// it. The name of the variable must be validated by the caller.
+func Export(name string, value string) string {
+	return "export " + Assign(name, value)
+}
+
+// Array returns a line that assigns the values to the array variable. The name
+// of the variable must be validated by the caller.
+func Array(name string, values []string) string {
+	return name + "=(" + Command(values...) + ")"
+}
+
+// Comment returns a single line comment with the text.
+func Comment(text string) string {
+	return "# " + strings.Replace(text, "\n", " ", -1)
+}
@@ -0,0 +1,80 @@
+package zsh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Feature: zsh code generation
+//
+//	Scenario: Quote values
+//	  When a value contains characters expanded by zsh
+//	  Then it is single-quoted
+//	  And single quotes are escaped
+func TestQuote(t *testing.T) {
+	cases := map[string]string{
+		"":                          "''",
+		"/home/user/.zpm_plugins":   "/home/user/.zpm_plugins",
+		"=ls":                       "'=ls'",
+		"a=b":                       "a=b",
+		"/home/John Doe":            "'/home/John Doe'",
+		"it's":                      `'it'\''s'`,
+		"$HOME":                     "'$HOME'",
+		"`rm -rf /`":                "'`rm -rf /`'",
+		"~/plugins":                 "'~/plugins'",
+		"/plugins/[abc]*":           "'/plugins/[abc]*'",
+		"line\nbreak":               "'line\nbreak'",
+		":completion:*":             "':completion:*'",
+		"/a/b/c.plugin.zsh":         "/a/b/c.plugin.zsh",
+		"/tmp/$(touch pwned)/x.zsh": "'/tmp/$(touch pwned)/x.zsh'",
+	}
+
+	for value, expected := range cases {
+		assert.Equal(t, expected, Quote(value), "invalid quoting")
+	}
+}
+
+// Scenario: Unquote values
+//
+//	When a value is quoted
+//	Then unquoting returns the original value
+func TestUnquote(t *testing.T) {
+	values := []string{"", "plain", "with space", "it's", "'''", "$HOME", "line\nbreak", `back\slash`}
+
+	for _, value := range values {
+		unquoted, err := Unquote(Quote(value))
+		require.Empty(t, err, "cannot unquote a quoted value")
+		assert.Equal(t, value, unquoted, "invalid unquoting")
+	}
+
+	for _, word := range []string{"$HOME", "a b", "'unterminated", `trailing\`} {
+		_, err := Unquote(word)
+		assert.NotEmpty(t, err, "must not unquote an expandable word")
+	}
+}
+
+// Scenario: Parse sourced files
+//
+//	When a line is generated by `Source`
+//	Then the path can be extracted from it
+func TestSourcedFile(t *testing.T) {
+	path, ok := SourcedFile(Source("/home/John Doe/it's.plugin.zsh"))
+	assert.True(t, ok, "must parse a source line")
+	assert.Equal(t, "/home/John Doe/it's.plugin.zsh", path, "invalid path")
+
+	_, ok = SourcedFile("for f (*.zsh); do source $f; done")
+	assert.False(t, ok, "must not parse arbitrary code")
+
+	_, ok = SourcedFile("source $HOME/plugin.zsh")
+	assert.False(t, ok, "must not parse expandable paths")
+}
+
+func TestAssignments(t *testing.T) {
+	assert.Equal(t, "export FOO='bar baz'", Export("FOO", "bar baz"))
+	assert.Equal(t, "0=/a/b.zsh", Assign("0", "/a/b.zsh"))
+	assert.Equal(t, "ARR=(history 'a b' '')", Array("ARR", []string{"history", "a b", ""}))
+	assert.Equal(t, "ARR=()", Array("ARR", nil))
+	assert.Equal(t, "# one two", Comment("one\ntwo"))
+}